@@ -0,0 +1,165 @@
+package mango
+
+// Kind identifies the type of a node in a parsed selector.
+type Kind int
+
+// Selector node kinds.
+const (
+	// KindEmpty is the empty selector, {}, which matches every document.
+	KindEmpty Kind = iota
+	// KindCombination is a combination operator, $and, $or, $nor or $not,
+	// whose children are the selectors it combines.
+	KindCombination
+	// KindCondition is a condition operator, such as $eq or $regex, applied
+	// to a field. It has no children.
+	KindCondition
+	// KindField is an operator which applies a selector to the elements of
+	// an array field, $elemMatch or $allMatch. Its only child is that
+	// selector.
+	KindField
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindEmpty:
+		return "empty"
+	case KindCombination:
+		return "combination"
+	case KindCondition:
+		return "condition"
+	case KindField:
+		return "field"
+	}
+	return "unknown"
+}
+
+// Kind returns the kind of the selector node.
+func (s *Selector) Kind() Kind {
+	switch s.op {
+	case opNone:
+		return KindEmpty
+	case opAnd, opOr, opNor, opNot:
+		return KindCombination
+	case opElemMatch, opAllMatch:
+		return KindField
+	}
+	return KindCondition
+}
+
+// Operator returns the node's operator, such as "$and" or "$eq". It is empty
+// for the empty selector. Implicit operators are made explicit, so
+// {"name":"Paul"} has the operator "$eq".
+func (s *Selector) Operator() string {
+	return string(s.op)
+}
+
+// Field returns the field a condition or field node applies to, in the
+// dotted notation of the selector, with literal periods escaped as `\.`.
+// It is empty for combination nodes, and for conditions within $elemMatch
+// or $allMatch which apply to the array element itself.
+func (s *Selector) Field() string {
+	return s.field
+}
+
+// Value returns a copy of the argument to a condition operator, as decoded by
+// encoding/json. It is nil for other kinds of node.
+func (s *Selector) Value() interface{} {
+	return copyValue(s.value)
+}
+
+// Children returns copies of the selectors combined by a combination node,
+// or applied by a field node.
+func (s *Selector) Children() []*Selector {
+	if len(s.sel) == 0 {
+		return nil
+	}
+	children := make([]*Selector, len(s.sel))
+	for i := range s.sel {
+		child := s.sel[i]
+		children[i] = &child
+	}
+	return children
+}
+
+// copyValue returns a deep copy of a value decoded by encoding/json.
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		c := make([]interface{}, len(t))
+		for i, e := range t {
+			c[i] = copyValue(e)
+		}
+		return c
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			c[k] = copyValue(e)
+		}
+		return c
+	}
+	return v
+}
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of sel
+// with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(sel *Selector) (w Visitor)
+}
+
+// Walk traverses a selector in depth-first order: It starts by calling
+// v.Visit(sel); sel must not be nil. If the visitor w returned by
+// v.Visit(sel) is not nil, Walk is invoked recursively with visitor w for
+// each of the children of sel, followed by a call of w.Visit(nil).
+func Walk(v Visitor, sel *Selector) {
+	if v = v.Visit(sel); v == nil {
+		return
+	}
+	for _, child := range sel.Children() {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(*Selector) bool
+
+func (f inspector) Visit(sel *Selector) Visitor {
+	if f(sel) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a selector in depth-first order: It starts by calling
+// f(sel); sel must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the children of sel, followed by a call of
+// f(nil).
+func Inspect(sel *Selector, f func(*Selector) bool) {
+	Walk(inspector(f), sel)
+}
+
+// Rewrite returns a copy of sel, in which each node has been replaced by the
+// result of calling f. Nodes are rewritten bottom-up, so f receives each
+// node after its children have been rewritten. If f returns nil, the node is
+// left unchanged. If f returns an error, Rewrite stops and returns it.
+func Rewrite(sel *Selector, f func(*Selector) (*Selector, error)) (*Selector, error) {
+	node := *sel
+	if len(sel.sel) > 0 {
+		node.sel = make([]Selector, len(sel.sel))
+		for i := range sel.sel {
+			child, err := Rewrite(&sel.sel[i], f)
+			if err != nil {
+				return nil, err
+			}
+			node.sel[i] = *child
+		}
+	}
+	result, err := f(&node)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return &node, nil
+	}
+	return result, nil
+}
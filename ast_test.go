@@ -0,0 +1,211 @@
+package mango
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestSelectorAccessors(t *testing.T) {
+	type saTest struct {
+		name     string
+		input    string
+		kind     Kind
+		op       string
+		field    string
+		value    interface{}
+		children int
+	}
+	tests := []saTest{
+		{
+			name:  "empty",
+			input: `{}`,
+			kind:  KindEmpty,
+		},
+		{
+			name:  "implicit $eq",
+			input: `{"name":"Paul"}`,
+			kind:  KindCondition,
+			op:    "$eq",
+			field: "name",
+			value: "Paul",
+		},
+		{
+			name:  "nested field",
+			input: `{"imdb":{"rating":{"$gt":8}}}`,
+			kind:  KindCondition,
+			op:    "$gt",
+			field: "imdb.rating",
+			value: float64(8),
+		},
+		{
+			name:  "escaped field",
+			input: `{"example\\.com":{"$exists":true}}`,
+			kind:  KindCondition,
+			op:    "$exists",
+			field: `example\.com`,
+			value: true,
+		},
+		{
+			name:     "implicit $and",
+			input:    `{"a":1,"b":2}`,
+			kind:     KindCombination,
+			op:       "$and",
+			children: 2,
+		},
+		{
+			name:     "$not",
+			input:    `{"$not":{"a":1}}`,
+			kind:     KindCombination,
+			op:       "$not",
+			children: 1,
+		},
+		{
+			name:     "$elemMatch",
+			input:    `{"genre":{"$elemMatch":{"$eq":"Horror"}}}`,
+			kind:     KindField,
+			op:       "$elemMatch",
+			field:    "genre",
+			children: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sel, err := New(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kind := sel.Kind(); kind != test.kind {
+				t.Errorf("Unexpected kind: %s", kind)
+			}
+			if op := sel.Operator(); op != test.op {
+				t.Errorf("Unexpected operator: %s", op)
+			}
+			if field := sel.Field(); field != test.field {
+				t.Errorf("Unexpected field: %s", field)
+			}
+			if d := testy.DiffInterface(test.value, sel.Value()); d != nil {
+				t.Error(d)
+			}
+			if n := len(sel.Children()); n != test.children {
+				t.Errorf("Unexpected number of children: %d", n)
+			}
+		})
+	}
+}
+
+func TestSelectorReadOnly(t *testing.T) {
+	sel, err := New(`{"$and":[{"a":{"$in":[1,2]}},{"b":3}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	children := sel.Children()
+	values, ok := children[0].Value().([]interface{})
+	if !ok {
+		t.Fatalf("Unexpected value: %v", children[0].Value())
+	}
+	values[0] = "x"
+	*children[1] = Selector{}
+	expected := Selector{
+		op: opAnd,
+		sel: []Selector{
+			{op: opIn, field: "a", value: []interface{}{float64(1), float64(2)}},
+			{op: opEq, field: "b", value: float64(3)},
+		},
+	}
+	if d := testy.DiffInterface(expected, *sel); d != nil {
+		t.Error(d)
+	}
+}
+
+type recorder []string
+
+func (r *recorder) Visit(sel *Selector) Visitor {
+	if sel == nil {
+		*r = append(*r, "end")
+		return nil
+	}
+	*r = append(*r, strings.TrimSpace(sel.Field()+" "+sel.Operator()))
+	return r
+}
+
+func TestWalk(t *testing.T) {
+	sel, err := New(`{"$or":[{"a":1},{"b":{"$elemMatch":{"$gt":2}}}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result recorder
+	Walk(&result, sel)
+	expected := recorder{"$or", "a $eq", "end", "b $elemMatch", "$gt", "end", "end", "end"}
+	if d := testy.DiffInterface(expected, result); d != nil {
+		t.Error(d)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	sel, err := New(`{"a":1,"$nor":[{"b":2}],"c":{"$elemMatch":{"d":3}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	Inspect(sel, func(s *Selector) bool {
+		if s == nil {
+			return false
+		}
+		if s.Kind() == KindCondition {
+			fields = append(fields, s.Field())
+		}
+		// Don't descend into $elemMatch, whose fields are relative.
+		return s.Kind() != KindField
+	})
+	if d := testy.DiffInterface([]string{"a", "b"}, fields); d != nil {
+		t.Error(d)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	t.Run("replace conditions", func(t *testing.T) {
+		sel, err := New(`{"$or":[{"status":"draft"},{"status":"deleted"}]}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Rewrite(sel, func(s *Selector) (*Selector, error) {
+			if s.Kind() != KindCondition {
+				return nil, nil
+			}
+			return New(fmt.Sprintf(`{"state":{"$eq":%q}}`, s.Value()))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := &Selector{
+			op: opOr,
+			sel: []Selector{
+				{op: opEq, field: "state", value: "draft"},
+				{op: opEq, field: "state", value: "deleted"},
+			},
+		}
+		if d := testy.DiffInterface(expected, result); d != nil {
+			t.Error(d)
+		}
+		if sel.sel[0].field != "status" {
+			t.Error("Original selector was modified")
+		}
+	})
+	t.Run("error", func(t *testing.T) {
+		sel, err := New(`{"a":1,"b":2}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Rewrite(sel, func(s *Selector) (*Selector, error) {
+			if s.Field() == "b" {
+				return nil, errors.New("field b is not allowed")
+			}
+			return nil, nil
+		})
+		testy.Error(t, "field b is not allowed", err)
+	})
+}
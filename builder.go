@@ -0,0 +1,270 @@
+package mango
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// FieldBuilder builds conditions on a single field. Create one with Field,
+// Path or Elem.
+//
+// Arguments are converted to the values encoding/json would decode them to,
+// so that the resulting selector is identical to the one parsed from the
+// equivalent JSON.
+//
+// Field, Path and the methods named after operators, such as Eq and Size,
+// panic on invalid input, such as a malformed field name, a negative size,
+// or an argument which cannot be marshaled to JSON, such as a NaN. They are
+// intended for field names and arguments written in code. For input supplied
+// by users, use ParseField, ParsePath, Condition and Regex, which return a
+// *ParseError instead.
+type FieldBuilder struct {
+	field string
+}
+
+// Field returns a builder for conditions on the named field, which uses the
+// same dotted notation as a selector. For example, "imdb.rating" refers to
+// the rating key within imdb. It panics if name is not a valid field name,
+// or begins with $, as it would be parsed as an operator. Use Path for field
+// names which are not known in advance.
+func Field(name string) FieldBuilder {
+	f, err := ParseField(name)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// ParseField is like Field, but returns a *ParseError, rather than
+// panicking, if name is not a valid field name.
+func ParseField(name string) (FieldBuilder, error) {
+	if _, err := splitField(name); err != nil {
+		return FieldBuilder{}, &ParseError{Reason: ReasonInvalidFieldName, Err: err, detail: name}
+	}
+	if strings.HasPrefix(name, "$") {
+		return FieldBuilder{}, parseError(ReasonInvalidFieldName, opNone, name, "invalid field name '%s'", name)
+	}
+	return FieldBuilder{field: name}, nil
+}
+
+// Path returns a builder for conditions on the field found by following the
+// object keys, or array indexes, in path. Unlike Field, periods within a
+// component are part of the key. It panics if path, or any of its
+// components, is empty, or if the first component begins with $.
+func Path(path ...string) FieldBuilder {
+	f, err := ParsePath(path...)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// ParsePath is like Path, but returns a *ParseError, rather than panicking,
+// if path is not valid.
+func ParsePath(path ...string) (FieldBuilder, error) {
+	invalid := len(path) == 0 || strings.HasPrefix(path[0], "$")
+	var field string
+	for _, name := range path {
+		invalid = invalid || name == ""
+		field = joinField(field, name)
+	}
+	if invalid {
+		return FieldBuilder{}, parseError(ReasonInvalidFieldName, opNone, field, "invalid field path %q", path)
+	}
+	return FieldBuilder{field: field}, nil
+}
+
+// Elem returns a builder for conditions on the array element itself, for
+// use within ElemMatch and AllMatch. Such a condition has no field, so it
+// cannot be marshaled to JSON outside of $elemMatch or $allMatch.
+func Elem() FieldBuilder {
+	return FieldBuilder{}
+}
+
+// Eq returns the condition {"field":{"$eq":v}}.
+func (f FieldBuilder) Eq(v interface{}) *Selector {
+	return f.condition(opEq, v)
+}
+
+// NE returns the condition {"field":{"$ne":v}}.
+func (f FieldBuilder) NE(v interface{}) *Selector {
+	return f.condition(opNE, v)
+}
+
+// LT returns the condition {"field":{"$lt":v}}.
+func (f FieldBuilder) LT(v interface{}) *Selector {
+	return f.condition(opLT, v)
+}
+
+// LTE returns the condition {"field":{"$lte":v}}.
+func (f FieldBuilder) LTE(v interface{}) *Selector {
+	return f.condition(opLTE, v)
+}
+
+// GT returns the condition {"field":{"$gt":v}}.
+func (f FieldBuilder) GT(v interface{}) *Selector {
+	return f.condition(opGT, v)
+}
+
+// GTE returns the condition {"field":{"$gte":v}}.
+func (f FieldBuilder) GTE(v interface{}) *Selector {
+	return f.condition(opGTE, v)
+}
+
+// Exists returns the condition {"field":{"$exists":exists}}.
+func (f FieldBuilder) Exists(exists bool) *Selector {
+	return f.condition(opExists, exists)
+}
+
+// Type returns the condition {"field":{"$type":typ}}, where typ is one of
+// "null", "boolean", "number", "string", "array" or "object".
+func (f FieldBuilder) Type(typ string) *Selector {
+	return f.condition(opType, typ)
+}
+
+// In returns the condition {"field":{"$in":[values...]}}.
+func (f FieldBuilder) In(values ...interface{}) *Selector {
+	return f.condition(opIn, array(values))
+}
+
+// NIn returns the condition {"field":{"$nin":[values...]}}.
+func (f FieldBuilder) NIn(values ...interface{}) *Selector {
+	return f.condition(opNIn, array(values))
+}
+
+// All returns the condition {"field":{"$all":[values...]}}.
+func (f FieldBuilder) All(values ...interface{}) *Selector {
+	return f.condition(opAll, array(values))
+}
+
+// Size returns the condition {"field":{"$size":n}}. It panics if n is
+// negative; use Condition if n is supplied by a user.
+func (f FieldBuilder) Size(n int) *Selector {
+	return f.condition(opSize, n)
+}
+
+// Mod returns the condition {"field":{"$mod":[divisor,remainder]}}. It
+// panics if divisor is less than 1; use Condition if divisor is supplied by
+// a user.
+func (f FieldBuilder) Mod(divisor, remainder int) *Selector {
+	return f.condition(opMod, []int{divisor, remainder})
+}
+
+// Regex returns the condition {"field":{"$regex":pattern}}. Unlike the
+// other methods named after operators, an invalid pattern is returned as a
+// *ParseError, as patterns are often supplied by users.
+func (f FieldBuilder) Regex(pattern string) (*Selector, error) {
+	sel, err := newCondition(f.field, opRegex, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &sel, nil
+}
+
+// ElemMatch returns the condition {"field":{"$elemMatch":sel}}. Within sel,
+// use Elem for conditions on the array element itself.
+func (f FieldBuilder) ElemMatch(sel *Selector) *Selector {
+	return &Selector{
+		op:    opElemMatch,
+		field: f.field,
+		sel:   []Selector{*sel},
+	}
+}
+
+// AllMatch returns the condition {"field":{"$allMatch":sel}}. Within sel,
+// use Elem for conditions on the array element itself.
+func (f FieldBuilder) AllMatch(sel *Selector) *Selector {
+	return &Selector{
+		op:    opAllMatch,
+		field: f.field,
+		sel:   []Selector{*sel},
+	}
+}
+
+// conditionOperators are the operators accepted by Condition.
+var conditionOperators = map[operator]bool{
+	opEq: true, opNE: true, opLT: true, opLTE: true, opGT: true, opGTE: true,
+	opExists: true, opType: true, opIn: true, opNIn: true, opAll: true,
+	opSize: true, opMod: true, opRegex: true,
+}
+
+// Condition returns the condition {"field":{op:v}}, where op is a condition
+// operator such as "$gt" or "$mod". Unlike the methods named after each
+// operator, it returns a *ParseError, rather than panicking, if op is not a
+// condition operator, or v is not a valid argument to it, so both may be
+// supplied by users.
+func (f FieldBuilder) Condition(op string, v interface{}) (*Selector, error) {
+	if !conditionOperators[operator(op)] {
+		return nil, parseError(ReasonInvalidOperator, operator(op), nil, "unknown mango condition operator '%s'", op)
+	}
+	value, err := decodedValue(v)
+	if err != nil {
+		return nil, &ParseError{Operator: op, Reason: ReasonBadArg, Err: err}
+	}
+	sel, err := newCondition(f.field, operator(op), value)
+	if err != nil {
+		return nil, err
+	}
+	return &sel, nil
+}
+
+// condition returns the condition op applied to f, with the argument v.
+func (f FieldBuilder) condition(op operator, v interface{}) *Selector {
+	sel, err := f.Condition(string(op), v)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// array returns values, or an empty array if it is nil, so that it
+// marshals to a JSON array.
+func array(values []interface{}) []interface{} {
+	if values == nil {
+		return []interface{}{}
+	}
+	return values
+}
+
+// decodedValue returns v as encoding/json would decode it from its JSON
+// representation.
+func decodedValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	return value, err
+}
+
+// And returns the selector {"$and":[sels...]}.
+func And(sels ...*Selector) *Selector {
+	return combination(opAnd, sels)
+}
+
+// Or returns the selector {"$or":[sels...]}.
+func Or(sels ...*Selector) *Selector {
+	return combination(opOr, sels)
+}
+
+// Nor returns the selector {"$nor":[sels...]}.
+func Nor(sels ...*Selector) *Selector {
+	return combination(opNor, sels)
+}
+
+// Not returns the selector {"$not":sel}.
+func Not(sel *Selector) *Selector {
+	return &Selector{
+		op:  opNot,
+		sel: []Selector{*sel},
+	}
+}
+
+func combination(op operator, sels []*Selector) *Selector {
+	s := &Selector{op: op}
+	for _, sel := range sels {
+		s.sel = append(s.sel, *sel)
+	}
+	return s
+}
@@ -0,0 +1,277 @@
+package mango
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestBuilder(t *testing.T) {
+	type bTest struct {
+		name     string
+		sel      *Selector
+		expected string
+	}
+	tests := []bTest{
+		{
+			name:     "$eq string",
+			sel:      Field("director").Eq("Lars von Trier"),
+			expected: `{"director":"Lars von Trier"}`,
+		},
+		{
+			name:     "$gte int",
+			sel:      Field("year").GTE(1990),
+			expected: `{"year":{"$gte":1990}}`,
+		},
+		{
+			name:     "$eq struct",
+			sel:      Field("a").Eq(struct{ B int }{B: 1}),
+			expected: `{"a":{"$eq":{"B":1}}}`,
+		},
+		{
+			name:     "dotted field",
+			sel:      Field("imdb.rating").LT(8),
+			expected: `{"imdb":{"rating":{"$lt":8}}}`,
+		},
+		{
+			name:     "path",
+			sel:      Path("sites", "example.com").Exists(true),
+			expected: `{"sites":{"example.com":{"$exists":true}}}`,
+		},
+		{
+			name:     "$in",
+			sel:      Field("genre").In("Horror", "Comedy"),
+			expected: `{"genre":{"$in":["Horror","Comedy"]}}`,
+		},
+		{
+			name:     "empty $nin",
+			sel:      Field("genre").NIn(),
+			expected: `{"genre":{"$nin":[]}}`,
+		},
+		{
+			name:     "$mod",
+			sel:      Field("year").Mod(4, 0),
+			expected: `{"year":{"$mod":[4,0]}}`,
+		},
+		{
+			name:     "$size",
+			sel:      Field("genre").Size(2),
+			expected: `{"genre":{"$size":2}}`,
+		},
+		{
+			name: "combinations",
+			sel: And(
+				Field("year").GT(2000),
+				Or(Field("a").NE(nil), Not(Field("b").Type("string"))),
+				Nor(),
+			),
+			expected: `{"$and":[{"year":{"$gt":2000}},{"$or":[{"a":{"$ne":null}},{"$not":{"b":{"$type":"string"}}}]},{"$nor":[]}]}`,
+		},
+		{
+			name:     "$elemMatch",
+			sel:      Field("genre").ElemMatch(Elem().Eq("Horror")),
+			expected: `{"genre":{"$elemMatch":{"$eq":"Horror"}}}`,
+		},
+		{
+			name:     "$allMatch",
+			sel:      Field("cast").AllMatch(And(Field("age").LTE(40), Field("name").All("x"))),
+			expected: `{"cast":{"$allMatch":{"$and":[{"age":{"$lte":40}},{"name":{"$all":["x"]}}]}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if d := testy.DiffInterface(mustNew(test.expected), test.sel); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestBuilderRegex(t *testing.T) {
+	sel, err := Field("title").Regex("^A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := testy.DiffInterface(mustNew(`{"title":{"$regex":"^A"}}`), sel); d != nil {
+		t.Error(d)
+	}
+	_, err = Field("title").Regex("(?=A)")
+	testy.Error(t, "invalid $regex pattern: lookahead assertions are not supported: `(?=`", err)
+}
+
+func TestBuilderPanics(t *testing.T) {
+	type bpTest struct {
+		name  string
+		build func()
+		err   string
+	}
+	tests := []bpTest{
+		{
+			name:  "invalid field name",
+			build: func() { Field("a..b") },
+			err:   "invalid field name 'a..b'",
+		},
+		{
+			name:  "operator as field name",
+			build: func() { Field("$foo") },
+			err:   "invalid field name '$foo'",
+		},
+		{
+			name:  "operator as first path component",
+			build: func() { Path("$foo", "bar") },
+			err:   `invalid field path ["$foo" "bar"]`,
+		},
+		{
+			name:  "empty path component",
+			build: func() { Path("a", "") },
+			err:   `invalid field path ["a" ""]`,
+		},
+		{
+			name:  "NaN",
+			build: func() { Field("a").Eq(math.NaN()) },
+			err:   "json: unsupported value: NaN",
+		},
+		{
+			name:  "negative size",
+			build: func() { Field("a").Size(-1) },
+			err:   "mango operator '$size' requires a non-negative integer argument",
+		},
+		{
+			name:  "zero divisor",
+			build: func() { Field("a").Mod(0, 1) },
+			err:   "mango operator '$mod' requires a positive integer divisor",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				testy.Error(t, test.err, err)
+			}()
+			test.build()
+		})
+	}
+}
+
+func TestBuilderMarshalElem(t *testing.T) {
+	const msg = "json: error calling MarshalJSON for type *mango.Selector: $eq condition is missing a field name outside of $elemMatch or $allMatch"
+	_, err := json.Marshal(Elem().Eq(1))
+	testy.Error(t, msg, err)
+	_, err = json.Marshal(Or(Field("a").Eq(1), Not(Elem().Eq(1))))
+	testy.Error(t, msg, err)
+	sel := Field("a").ElemMatch(Or(Elem().Eq(1), Not(Elem().Eq(2))))
+	data, err := json.Marshal(sel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := testy.DiffInterface(mustNew(string(data)), sel); d != nil {
+		t.Error(d)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	type beTest struct {
+		name   string
+		build  func() (*Selector, error)
+		reason Reason
+		err    string
+	}
+	condition := func(op string, v interface{}) func() (*Selector, error) {
+		return func() (*Selector, error) {
+			return Field("a").Condition(op, v)
+		}
+	}
+	tests := []beTest{
+		{
+			name: "invalid field name",
+			build: func() (*Selector, error) {
+				_, err := ParseField("a..b")
+				return nil, err
+			},
+			reason: ReasonInvalidFieldName,
+			err:    "invalid field name 'a..b'",
+		},
+		{
+			name: "operator as field name",
+			build: func() (*Selector, error) {
+				_, err := ParseField("$gt")
+				return nil, err
+			},
+			reason: ReasonInvalidFieldName,
+			err:    "invalid field name '$gt'",
+		},
+		{
+			name: "empty path",
+			build: func() (*Selector, error) {
+				_, err := ParsePath()
+				return nil, err
+			},
+			reason: ReasonInvalidFieldName,
+			err:    "invalid field path []",
+		},
+		{
+			name: "empty path component",
+			build: func() (*Selector, error) {
+				_, err := ParsePath("a", "")
+				return nil, err
+			},
+			reason: ReasonInvalidFieldName,
+			err:    `invalid field path ["a" ""]`,
+		},
+		{
+			name:   "combination operator",
+			build:  condition("$and", []interface{}{}),
+			reason: ReasonInvalidOperator,
+			err:    "unknown mango condition operator '$and'",
+		},
+		{
+			name:   "unknown operator",
+			build:  condition("$foo", 1),
+			reason: ReasonInvalidOperator,
+			err:    "unknown mango condition operator '$foo'",
+		},
+		{
+			name:   "NaN",
+			build:  condition("$gte", math.NaN()),
+			reason: ReasonBadArg,
+			err:    "json: unsupported value: NaN",
+		},
+		{
+			name:   "negative size",
+			build:  condition("$size", -1),
+			reason: ReasonBadArg,
+			err:    "mango operator '$size' requires a non-negative integer argument",
+		},
+		{
+			name:   "zero divisor",
+			build:  condition("$mod", []int{0, 1}),
+			reason: ReasonBadArg,
+			err:    "mango operator '$mod' requires a positive integer divisor",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.build()
+			testy.Error(t, test.err, err)
+			if perr, ok := err.(*ParseError); !ok || perr.Reason != test.reason {
+				t.Errorf("Expected a *ParseError with reason %s, got %#v", test.reason, err)
+			}
+		})
+	}
+}
+
+func TestBuilderCondition(t *testing.T) {
+	f, err := ParsePath("imdb", "rating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel, err := f.Condition("$mod", []int{2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := testy.DiffInterface(mustNew(`{"imdb.rating":{"$mod":[2,1]}}`), sel); d != nil {
+		t.Error(d)
+	}
+}
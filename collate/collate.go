@@ -1,12 +1,17 @@
 package collate
 
 import (
+	"fmt"
 	"math"
 	"reflect"
+	"sort"
 )
 
 // Collation provides an interface around a CouchDB collation definition.
 type Collation interface {
+	// Compare returns -1 if i is less than j, 0 if they are equal, and +1
+	// if i is greater than j.
+	Compare(i, j interface{}) int
 	Eq(i, j interface{}) bool
 	LT(i, j interface{}) bool
 	LTE(i, j interface{}) bool
@@ -44,6 +49,33 @@ const (
 	couchObject
 )
 
+// String returns the name CouchDB uses for the type, as accepted by the Mango
+// $type operator.
+func (t couchType) String() string {
+	switch t {
+	case couchNull:
+		return "null"
+	case couchBool:
+		return "boolean"
+	case couchNumber:
+		return "number"
+	case couchString:
+		return "string"
+	case couchArray:
+		return "array"
+	case couchObject:
+		return "object"
+	}
+	return "unknown"
+}
+
+// TypeName returns the name of the JSON type of i, as used by CouchDB: one of
+// "null", "boolean", "number", "string", "array" or "object". Values which
+// have no JSON representation, such as NaN, are reported as "null".
+func TypeName(i interface{}) string {
+	return couchTypeOf(i).String()
+}
+
 func couchTypeOf(i interface{}) couchType {
 	if i == nil {
 		return couchNull
@@ -69,3 +101,98 @@ func couchTypeOf(i interface{}) couchType {
 	}
 	panic("unknown type")
 }
+
+// stringCmp compares two strings, according to a particular collation.
+type stringCmp func(i, j string) comparison
+
+// compare compares i and j, using str to compare strings, including object
+// keys. All other values are compared the same way by every collation.
+func compare(i, j interface{}, str stringCmp) comparison {
+	iType, jType := couchTypeOf(i), couchTypeOf(j)
+	if iType < jType {
+		return lt
+	}
+	if iType > jType {
+		return gt
+	}
+	switch iType {
+	case couchBool, couchNumber, couchString:
+		if i == j {
+			return eq
+		}
+	}
+	switch iType {
+	case couchNull:
+		return eq
+	case couchBool:
+		if i.(bool) {
+			return gt
+		}
+		return lt
+	case couchNumber:
+		return numberCmp(i, j)
+	case couchString:
+		return str(i.(string), j.(string))
+	case couchArray:
+		return arrayCmp(i, j, str)
+	case couchObject:
+		return objectCmp(i, j, str)
+	}
+	panic(fmt.Sprintf("unknown couch type: %v", iType))
+}
+
+func arrayCmp(i, j interface{}, str stringCmp) comparison {
+	iv, jv := reflect.ValueOf(i), reflect.ValueOf(j)
+	maxLen := iv.Len()
+	if jv.Len() < maxLen {
+		maxLen = jv.Len()
+	}
+	for k := 0; k < maxLen; k++ {
+		if cmp := compare(iv.Index(k).Interface(), jv.Index(k).Interface(), str); cmp != eq {
+			return cmp
+		}
+	}
+	if iv.Len() == jv.Len() {
+		return eq
+	}
+	if iv.Len() < jv.Len() {
+		return lt
+	}
+	return gt
+}
+
+// objectCmp compares two objects member by member. The members of a Go map
+// have no order, so they are compared in byte-wise order of their keys.
+func objectCmp(i, j interface{}, str stringCmp) comparison {
+	iv := i.(map[string]interface{})
+	jv := j.(map[string]interface{})
+	ikeys := make([]string, 0, len(iv))
+	jkeys := make([]string, 0, len(jv))
+	for k := range iv {
+		ikeys = append(ikeys, k)
+	}
+	for k := range jv {
+		jkeys = append(jkeys, k)
+	}
+	sort.Strings(ikeys)
+	sort.Strings(jkeys)
+	maxLen := len(ikeys)
+	if maxLen > len(jkeys) {
+		maxLen = len(jkeys)
+	}
+	for k := 0; k < maxLen; k++ {
+		if cmp := str(ikeys[k], jkeys[k]); cmp != eq {
+			return cmp
+		}
+		if cmp := compare(iv[ikeys[k]], jv[jkeys[k]], str); cmp != eq {
+			return cmp
+		}
+	}
+	if len(ikeys) < len(jkeys) {
+		return lt
+	}
+	if len(ikeys) > len(jkeys) {
+		return gt
+	}
+	return eq
+}
@@ -136,3 +136,55 @@ func TestCouchTypeOf(t *testing.T) {
 		})
 	}
 }
+
+func TestTypeName(t *testing.T) {
+	type tnTest struct {
+		name     string
+		input    interface{}
+		expected string
+	}
+	tests := []tnTest{
+		{
+			name:     "nil",
+			expected: "null",
+		},
+		{
+			name:     "NaN",
+			input:    math.NaN(),
+			expected: "null",
+		},
+		{
+			name:     "bool",
+			input:    false,
+			expected: "boolean",
+		},
+		{
+			name:     "number",
+			input:    float64(1),
+			expected: "number",
+		},
+		{
+			name:     "string",
+			input:    "foo",
+			expected: "string",
+		},
+		{
+			name:     "array",
+			input:    []interface{}{"foo"},
+			expected: "array",
+		},
+		{
+			name:     "object",
+			input:    map[string]interface{}{"foo": "bar"},
+			expected: "object",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := TypeName(test.input)
+			if result != test.expected {
+				t.Errorf("Unexpected result: %s", result)
+			}
+		})
+	}
+}
@@ -1,10 +1,7 @@
 package collate
 
 import (
-	"fmt"
 	"math"
-	"reflect"
-	"sort"
 )
 
 // Raw provides raw (byte-wise) collation of strings.
@@ -13,37 +10,7 @@ type Raw struct{}
 var _ Collation = &Raw{}
 
 func (r *Raw) cmp(i, j interface{}) comparison {
-	iType, jType := couchTypeOf(i), couchTypeOf(j)
-	if iType < jType {
-		return lt
-	}
-	if iType > jType {
-		return gt
-	}
-	switch iType {
-	case couchBool, couchNumber, couchString:
-		if i == j {
-			return eq
-		}
-	}
-	switch iType {
-	case couchNull:
-		return eq
-	case couchBool:
-		if i.(bool) {
-			return gt
-		}
-		return lt
-	case couchNumber:
-		return numberCmp(i, j)
-	case couchString:
-		return r.stringCmp(i.(string), j.(string))
-	case couchArray:
-		return r.arrayCmp(i, j)
-	case couchObject:
-		return r.objectCmp(i, j)
-	}
-	panic(fmt.Sprintf("unknown couch type: %v", iType))
+	return compare(i, j, r.stringCmp)
 }
 
 func (r *Raw) stringCmp(i, j string) comparison {
@@ -57,58 +24,11 @@ func (r *Raw) stringCmp(i, j string) comparison {
 }
 
 func (r *Raw) arrayCmp(i, j interface{}) comparison {
-	iv, jv := reflect.ValueOf(i), reflect.ValueOf(j)
-	maxLen := iv.Len()
-	if jv.Len() < maxLen {
-		maxLen = jv.Len()
-	}
-	for k := 0; k < maxLen; k++ {
-		if cmp := r.cmp(iv.Index(k).Interface(), jv.Index(k).Interface()); cmp != eq {
-			return cmp
-		}
-	}
-	if iv.Len() == jv.Len() {
-		return eq
-	}
-	if iv.Len() < jv.Len() {
-		return lt
-	}
-	return gt
+	return arrayCmp(i, j, r.stringCmp)
 }
 
 func (r *Raw) objectCmp(i, j interface{}) comparison {
-	iv := i.(map[string]interface{})
-	jv := j.(map[string]interface{})
-	ikeys := make([]string, 0, len(iv))
-	jkeys := make([]string, 0, len(jv))
-	for k := range iv {
-		ikeys = append(ikeys, k)
-	}
-	for k := range jv {
-		jkeys = append(jkeys, k)
-	}
-	sort.Strings(ikeys)
-	sort.Strings(jkeys)
-	maxLen := len(ikeys)
-	if maxLen > len(jkeys) {
-		maxLen = len(jkeys)
-	}
-	for k := 0; k < maxLen; k++ {
-		if cmp := r.stringCmp(ikeys[k], jkeys[k]); cmp != eq {
-			return cmp
-		}
-		key := ikeys[k]
-		if cmp := r.cmp(iv[key], jv[key]); cmp != eq {
-			return cmp
-		}
-	}
-	if len(ikeys) < len(jkeys) {
-		return lt
-	}
-	if len(ikeys) > len(jkeys) {
-		return gt
-	}
-	return eq
+	return objectCmp(i, j, r.stringCmp)
 }
 
 func numberCmp(i, j interface{}) comparison {
@@ -152,6 +72,12 @@ func toFloat(i interface{}) float64 {
 	return math.NaN()
 }
 
+// Compare returns -1 if i is less than j, 0 if they are equal, and +1 if i
+// is greater than j.
+func (r *Raw) Compare(i, j interface{}) int {
+	return int(r.cmp(i, j))
+}
+
 // Eq returns true if i and j are equal.
 func (r *Raw) Eq(i, j interface{}) bool {
 	return r.cmp(i, j) == eq
@@ -0,0 +1,34 @@
+package collate
+
+import (
+	"sort"
+)
+
+// Slice attaches the methods of sort.Interface to a slice of JSON values,
+// such as view keys, ordered by a collation.
+type Slice struct {
+	Collation Collation
+	Values    []interface{}
+}
+
+var _ sort.Interface = Slice{}
+
+func (s Slice) Len() int           { return len(s.Values) }
+func (s Slice) Less(i, j int) bool { return s.Collation.Compare(s.Values[i], s.Values[j]) < 0 }
+func (s Slice) Swap(i, j int)      { s.Values[i], s.Values[j] = s.Values[j], s.Values[i] }
+
+// Sort sorts values in increasing order according to c. Equal values retain
+// their original order.
+func Sort(c Collation, values []interface{}) {
+	sort.Stable(Slice{Collation: c, Values: values})
+}
+
+// SortSlice sorts the slice x, such as a slice of view result rows, in
+// increasing order of the keys returned by key for each index, according to
+// c. Elements with equal keys retain their original order. As for
+// sort.Slice, it panics if x is not a slice.
+func SortSlice(c Collation, x interface{}, key func(i int) interface{}) {
+	sort.SliceStable(x, func(i, j int) bool {
+		return c.Compare(key(i), key(j)) < 0
+	})
+}
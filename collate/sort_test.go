@@ -0,0 +1,87 @@
+package collate
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		c        Collation
+		i, j     interface{}
+		expected int
+	}{
+		{name: "raw less", c: &Raw{}, i: "A", j: "a", expected: -1},
+		{name: "raw equal", c: &Raw{}, i: 1, j: 1.0, expected: 0},
+		{name: "raw greater", c: &Raw{}, i: "b", j: "B", expected: 1},
+		{name: "unicode less", c: &Unicode{}, i: "a", j: "A", expected: -1},
+		{name: "unicode equal", c: &Unicode{}, i: []interface{}{"a"}, j: []interface{}{"a"}, expected: 0},
+		{name: "unicode greater", c: &Unicode{}, i: "b", j: "A", expected: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := test.c.Compare(test.i, test.j); result != test.expected {
+				t.Errorf("Unexpected result: %d", result)
+			}
+		})
+	}
+}
+
+func shuffled(values []interface{}) []interface{} {
+	result := append([]interface{}{}, values...)
+	r := rand.New(rand.NewSource(1))
+	r.Shuffle(len(result), func(i, j int) {
+		result[i], result[j] = result[j], result[i]
+	})
+	return result
+}
+
+func TestSort(t *testing.T) {
+	values := shuffled(couchDBOrder)
+	Sort(&Unicode{}, values)
+	if d := testy.DiffInterface(couchDBOrder, values); d != nil {
+		t.Error(d)
+	}
+}
+
+func TestSortStable(t *testing.T) {
+	values := []interface{}{"b", 1, "a", 1.0, "a"}
+	Sort(&Raw{}, values)
+	expected := []interface{}{1, 1.0, "a", "a", "b"}
+	if !reflect.DeepEqual(expected, values) {
+		t.Errorf("Unexpected result: %v", values)
+	}
+}
+
+func TestSortSlice(t *testing.T) {
+	type row struct {
+		ID  string
+		Key interface{}
+	}
+	rows := []row{
+		{ID: "1", Key: "b"},
+		{ID: "2", Key: nil},
+		{ID: "3", Key: "A"},
+		{ID: "4", Key: []interface{}{"a"}},
+		{ID: "5", Key: "a"},
+		{ID: "6", Key: "b"},
+	}
+	SortSlice(&Unicode{}, rows, func(i int) interface{} {
+		return rows[i].Key
+	})
+	expected := []row{
+		{ID: "2", Key: nil},
+		{ID: "5", Key: "a"},
+		{ID: "3", Key: "A"},
+		{ID: "1", Key: "b"},
+		{ID: "6", Key: "b"},
+		{ID: "4", Key: []interface{}{"a"}},
+	}
+	if d := testy.DiffInterface(expected, rows); d != nil {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,77 @@
+package collate
+
+import (
+	"sync"
+
+	uca "golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Unicode provides CouchDB's default collation, in which strings are ordered
+// by the Unicode Collation Algorithm. CouchDB uses ICU's root collator, with
+// its default settings, which orders strings by the Default Unicode Collation
+// Element Table (DUCET) with the tailoring of the CLDR root locale. Letters
+// sort case-insensitively before case is considered, with lower case first,
+// so that "a" < "A" < "aa" < "b". Punctuation and spaces are not ignored,
+// and sort before digits, which sort before letters. Canonically equivalent
+// strings, such as the composed and decomposed forms of "é", are equal.
+//
+// Objects are compared member by member, in byte-wise order of their keys,
+// with keys compared by the same collation as strings.
+//
+// A Unicode collation is safe for concurrent use.
+type Unicode struct{}
+
+var _ Collation = &Unicode{}
+
+// collators holds ICU-compatible root collators, which are not safe for
+// concurrent use.
+var collators = sync.Pool{
+	New: func() interface{} {
+		return uca.New(language.Und)
+	},
+}
+
+func (u *Unicode) cmp(i, j interface{}) comparison {
+	return compare(i, j, u.stringCmp)
+}
+
+func (u *Unicode) stringCmp(i, j string) comparison {
+	if i == j {
+		return eq
+	}
+	c := collators.Get().(*uca.Collator)
+	defer collators.Put(c)
+	return comparison(c.CompareString(i, j))
+}
+
+// Compare returns -1 if i is less than j, 0 if they are equal, and +1 if i
+// is greater than j.
+func (u *Unicode) Compare(i, j interface{}) int {
+	return int(u.cmp(i, j))
+}
+
+// Eq returns true if i and j are equal.
+func (u *Unicode) Eq(i, j interface{}) bool {
+	return u.cmp(i, j) == eq
+}
+
+// LT returns true if i is less than j.
+func (u *Unicode) LT(i, j interface{}) bool {
+	return u.cmp(i, j) == lt
+}
+
+// LTE returns true if i is less than or equal to j.
+func (u *Unicode) LTE(i, j interface{}) bool {
+	return u.cmp(i, j) <= eq
+}
+
+// GT returns true if i is greater than j.
+func (u *Unicode) GT(i, j interface{}) bool {
+	return u.cmp(i, j) == gt
+}
+
+// GTE returns true if i is greater than or equal to j.
+func (u *Unicode) GTE(i, j interface{}) bool {
+	return u.cmp(i, j) >= eq
+}
@@ -0,0 +1,114 @@
+package collate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// couchDBOrder lists keys in the order CouchDB collates them, as given in
+// the CouchDB documentation on view collation.
+var couchDBOrder = []interface{}{
+	nil,
+	false,
+	true,
+	1, 2, 3.0, 4,
+	"a", "A", "aa", "b", "B", "ba", "bb",
+	[]interface{}{"a"},
+	[]interface{}{"b"},
+	[]interface{}{"b", "c"},
+	[]interface{}{"b", "c", "a"},
+	[]interface{}{"b", "d"},
+	[]interface{}{"b", "d", "e"},
+	map[string]interface{}{"a": 1},
+	map[string]interface{}{"a": 2},
+	map[string]interface{}{"b": 1},
+	map[string]interface{}{"b": 2},
+	map[string]interface{}{"b": 2, "c": 2},
+}
+
+// couchDBASCII lists printable ASCII characters in the order CouchDB
+// collates them, as given in the CouchDB documentation.
+const couchDBASCII = "_ - , ; : ! ? . ' \" ( ) [ ] { } @ * / \\ & # % ` ^ + < = > | ~ $ " +
+	"0 1 2 3 4 5 6 7 8 9 " +
+	"a A b B c C d D e E f F g G h H i I j J k K l L m M n N o O p P q Q r R " +
+	"s S t T u U v V w W x X y Y z Z"
+
+func testOrder(t *testing.T, c Collation, keys []interface{}) {
+	t.Helper()
+	for i, a := range keys {
+		for j, b := range keys {
+			var ok bool
+			switch {
+			case i < j:
+				ok = c.LT(a, b) && c.LTE(a, b) && !c.Eq(a, b) && !c.GT(a, b) && !c.GTE(a, b)
+			case i > j:
+				ok = c.GT(a, b) && c.GTE(a, b) && !c.Eq(a, b) && !c.LT(a, b) && !c.LTE(a, b)
+			default:
+				ok = c.Eq(a, b) && c.LTE(a, b) && c.GTE(a, b) && !c.LT(a, b) && !c.GT(a, b)
+			}
+			if !ok {
+				t.Errorf("%v (#%d) and %v (#%d) collated out of order", a, i, b, j)
+			}
+		}
+	}
+}
+
+func TestUnicodeOrder(t *testing.T) {
+	c := &Unicode{}
+	t.Run("keys", func(t *testing.T) {
+		testOrder(t, c, couchDBOrder)
+	})
+	t.Run("ASCII", func(t *testing.T) {
+		fields := strings.Fields(couchDBASCII)
+		keys := make([]interface{}, len(fields))
+		for i, f := range fields {
+			keys[i] = f
+		}
+		testOrder(t, c, keys)
+	})
+	t.Run("strings", func(t *testing.T) {
+		testOrder(t, c, []interface{}{
+			"", " ", "-", "a", "a b", "a-b", "ab", "abc", "b", "é", "f",
+		})
+	})
+}
+
+func TestUnicodeCmp(t *testing.T) {
+	c := &Unicode{}
+	tests := []struct {
+		i, j     interface{}
+		expected comparison
+	}{
+		{i: "a", j: "a", expected: eq},
+		{i: "a", j: "A", expected: lt},
+		{i: "A", j: "aa", expected: lt},
+		{i: "Z", j: "a", expected: gt},
+		{i: "10", j: "9", expected: lt},
+		{i: "a", j: "á", expected: lt},
+		{i: "á", j: "b", expected: lt},
+		// Composed and decomposed forms of é
+		{i: "é", j: "e\u0301", expected: eq},
+		{i: []interface{}{"é"}, j: []interface{}{"e\u0301"}, expected: eq},
+		{
+			i:        map[string]interface{}{"é": 1},
+			j:        map[string]interface{}{"e\u0301": 1},
+			expected: eq,
+		},
+		{
+			i:        map[string]interface{}{"a": 1},
+			j:        map[string]interface{}{"A": 1},
+			expected: lt,
+		},
+		{i: 1, j: "1", expected: lt},
+		{i: "z", j: []interface{}{}, expected: lt},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v vs %v", test.i, test.j), func(t *testing.T) {
+			result := c.cmp(test.i, test.j)
+			if result != test.expected {
+				t.Errorf("Unexpected result: %s", result)
+			}
+		})
+	}
+}
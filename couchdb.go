@@ -0,0 +1,192 @@
+package mango
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CouchDBError is a selector parse error in the form CouchDB reports it, as
+// produced by its mango_error module. It marshals to the JSON body of a
+// CouchDB error response.
+type CouchDBError struct {
+	// Status is the HTTP status code.
+	Status int `json:"-"`
+	// Name is the short error name, such as "bad_arg" or
+	// "invalid_operator".
+	Name string `json:"error"`
+	// Reason is the human-readable description of the error.
+	Reason string `json:"reason"`
+
+	err *ParseError
+}
+
+var _ error = &CouchDBError{}
+
+func (e *CouchDBError) Error() string {
+	return e.Reason
+}
+
+// StatusCode returns the HTTP status code.
+func (e *CouchDBError) StatusCode() int {
+	return e.Status
+}
+
+// Unwrap returns the *ParseError from which e was converted.
+func (e *CouchDBError) Unwrap() error {
+	return e.err
+}
+
+// CouchDB returns e converted to the error CouchDB would return for the
+// same selector. Offending values are formatted as Erlang terms, as CouchDB
+// does; object keys are sorted, as their original order is not retained.
+func (e *ParseError) CouchDB() *CouchDBError {
+	ce := &CouchDBError{
+		Status: http.StatusBadRequest,
+		err:    e,
+	}
+	switch e.Reason {
+	case ReasonInvalidJSON:
+		ce.Name = "bad_request"
+		ce.Reason = "invalid UTF-8 JSON"
+	case ReasonInvalidSelector:
+		ce.Name = "invalid_selector_json"
+		ce.Reason = "Selector must be a JSON object, not: " + erlangTerm(e.detail)
+	case ReasonInvalidOperator:
+		ce.Name = "invalid_operator"
+		ce.Reason = "Invalid operator: " + e.Operator
+	case ReasonBadArg:
+		ce.Name = "bad_arg"
+		ce.Reason = fmt.Sprintf("Bad argument for operator %s: %s", e.Operator, erlangTerm(e.detail))
+	case ReasonMissingFieldName:
+		ce.Name = "invalid_selector"
+		ce.Reason = "One or more conditions is missing a field name."
+	case ReasonInvalidFieldName:
+		ce.Name = "invalid_field_name"
+		ce.Reason = fmt.Sprintf("Invalid field name: %s", e.detail)
+	default:
+		ce.Name = "bad_request"
+		ce.Reason = e.Err.Error()
+	}
+	return ce
+}
+
+// Option modifies the behavior of New.
+type Option func(*options)
+
+type options struct {
+	couchDBErrors bool
+}
+
+// CouchDBErrors causes New to return parse errors as *CouchDBError, with the
+// same error names, reasons and status codes as CouchDB, so that local
+// validation is interchangeable with a server response. The original
+// *ParseError remains available with errors.As.
+func CouchDBErrors() Option {
+	return func(o *options) {
+		o.couchDBErrors = true
+	}
+}
+
+// erlangTerm formats a decoded JSON value as Erlang's io_lib formats it with
+// ~w, after decoding by jiffy.
+func erlangTerm(v interface{}) string {
+	var buf bytes.Buffer
+	writeErlangTerm(&buf, v)
+	return buf.String()
+}
+
+func writeErlangTerm(buf *bytes.Buffer, v interface{}) {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case float64:
+		buf.WriteString(erlangNumber(t))
+	case string:
+		writeErlangBinary(buf, t)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeErlangTerm(buf, elem)
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteString("{[")
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('{')
+			writeErlangBinary(buf, k)
+			buf.WriteByte(',')
+			writeErlangTerm(buf, t[k])
+			buf.WriteByte('}')
+		}
+		buf.WriteString("]}")
+	default:
+		fmt.Fprintf(buf, "%v", t)
+	}
+}
+
+// erlangNumber formats f as an integer if it is whole, as jiffy decodes
+// integral JSON numbers to integers, or otherwise as an Erlang float.
+func erlangNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	mantissa, exp := s, ""
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		mantissa = s[:i]
+		// Erlang omits the sign of positive exponents, and leading zeros.
+		var sign string
+		if s[i+1] == '-' {
+			sign = "-"
+		}
+		exp = "e" + sign + strings.TrimLeft(s[i+2:], "0")
+	}
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	return mantissa + exp
+}
+
+// writeErlangBinary formats s as an Erlang binary. Binaries consisting of
+// printable ASCII are written as strings; others as a list of bytes.
+func writeErlangBinary(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e {
+			buf.WriteString("<<")
+			for j := 0; j < len(s); j++ {
+				if j > 0 {
+					buf.WriteByte(',')
+				}
+				buf.WriteString(strconv.Itoa(int(s[j])))
+			}
+			buf.WriteString(">>")
+			return
+		}
+	}
+	buf.WriteString(`<<"`)
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	buf.WriteString(`">>`)
+}
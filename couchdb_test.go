@@ -0,0 +1,119 @@
+package mango
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestCouchDBErrors(t *testing.T) {
+	type ceTest struct {
+		name     string
+		input    string
+		expected string
+	}
+	tests := []ceTest{
+		{
+			name:     "invalid JSON",
+			input:    `{"foo":`,
+			expected: `{"error":"bad_request","reason":"invalid UTF-8 JSON"}`,
+		},
+		{
+			name:     "not an object",
+			input:    `["foo",1]`,
+			expected: `{"error":"invalid_selector_json","reason":"Selector must be a JSON object, not: [<<\"foo\">>,1]"}`,
+		},
+		{
+			name:     "invalid operator",
+			input:    `{"foo":{"$invalid":"bar"}}`,
+			expected: `{"error":"invalid_operator","reason":"Invalid operator: $invalid"}`,
+		},
+		{
+			name:     "bad argument",
+			input:    `{"foo":{"$in":{"a":[true,null,1.5]}}}`,
+			expected: `{"error":"bad_arg","reason":"Bad argument for operator $in: {[{<<\"a\">>,[true,null,1.5]}]}"}`,
+		},
+		{
+			name:     "bad $mod divisor",
+			input:    `{"foo":{"$mod":[0,1]}}`,
+			expected: `{"error":"bad_arg","reason":"Bad argument for operator $mod: 0"}`,
+		},
+		{
+			name:     "bad $regex",
+			input:    `{"foo":{"$regex":"(?=a)"}}`,
+			expected: `{"error":"bad_arg","reason":"Bad argument for operator $regex: <<\"(?=a)\">>"}`,
+		},
+		{
+			name:     "missing field name",
+			input:    `{"$gt":1}`,
+			expected: `{"error":"invalid_selector","reason":"One or more conditions is missing a field name."}`,
+		},
+		{
+			name:     "invalid field name",
+			input:    `{"a..b":1}`,
+			expected: `{"error":"invalid_field_name","reason":"Invalid field name: a..b"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.input, CouchDBErrors())
+			var cerr *CouchDBError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("Expected *CouchDBError, got %T", err)
+			}
+			if cerr.StatusCode() != 400 {
+				t.Errorf("Unexpected status: %d", cerr.StatusCode())
+			}
+			if err.Error() != cerr.Reason {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(cerr); err != nil {
+				t.Fatal(err)
+			}
+			if d := testy.DiffText(test.expected+"\n", buf.String()); d != nil {
+				t.Error(d)
+			}
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Error("Expected to unwrap to *ParseError")
+			}
+		})
+	}
+}
+
+func TestErlangTerm(t *testing.T) {
+	type etTest struct {
+		name     string
+		input    interface{}
+		expected string
+	}
+	tests := []etTest{
+		{name: "null", input: nil, expected: "null"},
+		{name: "true", input: true, expected: "true"},
+		{name: "integer", input: float64(-3), expected: "-3"},
+		{name: "float", input: 0.25, expected: "0.25"},
+		{name: "small float", input: 1.5e-7, expected: "1.5e-7"},
+		{name: "large float", input: 1e21, expected: "1.0e21"},
+		{name: "string", input: `a"b\c`, expected: `<<"a\"b\\c">>`},
+		{name: "non-ASCII string", input: "é", expected: "<<195,169>>"},
+		{name: "array", input: []interface{}{"a", float64(1)}, expected: `[<<"a">>,1]`},
+		{
+			name:     "object",
+			input:    map[string]interface{}{"b": false, "a": []interface{}{}},
+			expected: `{[{<<"a">>,[]},{<<"b">>,false}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := erlangTerm(test.input); result != test.expected {
+				t.Errorf("Unexpected result: %s", result)
+			}
+		})
+	}
+}
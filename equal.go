@@ -0,0 +1,149 @@
+package mango
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/go-kivik/mango/collate"
+)
+
+// Equal returns true if s and other are structurally identical, disregarding
+// the order of the clauses within $and, $or and $nor, so that
+// {"a":1,"b":2} is equal to {"b":2,"a":1}. Literal values are compared with
+// raw collation, as by Matches.
+//
+// Equal does not otherwise consider whether two selectors match the same
+// documents. Normalize both selectors first to also disregard redundant
+// clauses and nesting.
+func (s *Selector) Equal(other *Selector) bool {
+	a, b := canonical(*s), canonical(*other)
+	return compareSelectors(&a, &b) == 0
+}
+
+// Hash returns a hash of the selector, which is the same for any two
+// selectors which are Equal.
+func (s *Selector) Hash() uint64 {
+	h := fnv.New64a()
+	c := canonical(*s)
+	hashSelector(h, &c)
+	return h.Sum64()
+}
+
+// canonical returns a copy of s in which the clauses of each $and, $or and
+// $nor are sorted.
+func canonical(s Selector) Selector {
+	if len(s.sel) == 0 {
+		return s
+	}
+	sels := make([]Selector, len(s.sel))
+	for i, sel := range s.sel {
+		sels[i] = canonical(sel)
+	}
+	switch s.op {
+	case opAnd, opOr, opNor:
+		sort.SliceStable(sels, func(i, j int) bool {
+			return compareSelectors(&sels[i], &sels[j]) < 0
+		})
+	}
+	s.sel = sels
+	return s
+}
+
+// compareSelectors orders canonical selectors by operator, field, value and
+// clauses, in that order.
+func compareSelectors(a, b *Selector) int {
+	if cmp := strings.Compare(string(a.op), string(b.op)); cmp != 0 {
+		return cmp
+	}
+	if cmp := strings.Compare(a.field, b.field); cmp != 0 {
+		return cmp
+	}
+	if cmp := (&collate.Raw{}).Compare(a.value, b.value); cmp != 0 {
+		return cmp
+	}
+	if len(a.sel) != len(b.sel) {
+		if len(a.sel) < len(b.sel) {
+			return -1
+		}
+		return 1
+	}
+	for i := range a.sel {
+		if cmp := compareSelectors(&a.sel[i], &b.sel[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func hashSelector(h hash.Hash64, s *Selector) {
+	hashString(h, string(s.op))
+	hashString(h, s.field)
+	hashValue(h, s.value)
+	hashLen(h, len(s.sel))
+	for i := range s.sel {
+		hashSelector(h, &s.sel[i])
+	}
+}
+
+// hashValue hashes a JSON value, such that values equal by CouchDB's raw
+// collation have the same hash.
+func hashValue(h hash.Hash64, v interface{}) {
+	switch t := v.(type) {
+	case nil:
+		_, _ = h.Write([]byte{'n'})
+	case bool:
+		if t {
+			_, _ = h.Write([]byte{'t'})
+		} else {
+			_, _ = h.Write([]byte{'f'})
+		}
+	case string:
+		_, _ = h.Write([]byte{'s'})
+		hashString(h, t)
+	case []interface{}:
+		_, _ = h.Write([]byte{'a'})
+		hashLen(h, len(t))
+		for _, elem := range t {
+			hashValue(h, elem)
+		}
+	case map[string]interface{}:
+		_, _ = h.Write([]byte{'o'})
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		hashLen(h, len(keys))
+		for _, k := range keys {
+			hashString(h, k)
+			hashValue(h, t[k])
+		}
+	default:
+		// Values are decoded by encoding/json, so any other value is a
+		// number.
+		f, _ := t.(float64)
+		if f == 0 {
+			// Collate -0 equal to 0.
+			f = 0
+		}
+		var buf [9]byte
+		buf[0] = 'd'
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(f))
+		_, _ = h.Write(buf[:])
+	}
+}
+
+func hashString(h hash.Hash64, s string) {
+	hashLen(h, len(s))
+	_, _ = h.Write([]byte(s))
+}
+
+func hashLen(h hash.Hash64, n int) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	_, _ = h.Write(buf[:])
+}
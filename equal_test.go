@@ -0,0 +1,98 @@
+package mango
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	type eTest struct {
+		name     string
+		a, b     string
+		expected bool
+	}
+	tests := []eTest{
+		{
+			name:     "empty",
+			a:        `{}`,
+			b:        `{}`,
+			expected: true,
+		},
+		{
+			name:     "implicit and explicit $eq",
+			a:        `{"a":1}`,
+			b:        `{"a":{"$eq":1.0}}`,
+			expected: true,
+		},
+		{
+			name:     "key order",
+			a:        `{"a":1,"b":{"$gt":2,"$lt":5}}`,
+			b:        `{"b":{"$lt":5,"$gt":2},"a":1}`,
+			expected: true,
+		},
+		{
+			name:     "$or order",
+			a:        `{"$or":[{"a":1},{"b":[1,{"x":null,"y":true}]}]}`,
+			b:        `{"$or":[{"b":[1,{"y":true,"x":null}]},{"a":1}]}`,
+			expected: true,
+		},
+		{
+			name:     "negative zero",
+			a:        `{"a":0}`,
+			b:        `{"a":-0}`,
+			expected: true,
+		},
+		{
+			name:     "nested object",
+			a:        `{"a":{"b":1}}`,
+			b:        `{"a.b":1}`,
+			expected: true,
+		},
+		{
+			name: "different values",
+			a:    `{"a":1}`,
+			b:    `{"a":"1"}`,
+		},
+		{
+			name: "different fields",
+			a:    `{"a":1}`,
+			b:    `{"b":1}`,
+		},
+		{
+			name: "different operators",
+			a:    `{"a":{"$gt":1}}`,
+			b:    `{"a":{"$gte":1}}`,
+		},
+		{
+			name: "$and and $or",
+			a:    `{"$and":[{"a":1},{"b":1}]}`,
+			b:    `{"$or":[{"a":1},{"b":1}]}`,
+		},
+		{
+			name: "array order is significant",
+			a:    `{"a":{"$in":[1,2]}}`,
+			b:    `{"a":{"$in":[2,1]}}`,
+		},
+		{
+			name: "extra clause",
+			a:    `{"a":1,"b":2}`,
+			b:    `{"a":1,"b":2,"c":3}`,
+		},
+		{
+			name: "not normalized",
+			a:    `{"a":1}`,
+			b:    `{"$and":[{"a":1}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := mustNew(test.a), mustNew(test.b)
+			if result := a.Equal(b); result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+			if result := b.Equal(a); result != test.expected {
+				t.Errorf("Expected %t in reverse, got %t", test.expected, result)
+			}
+			if hashEqual := a.Hash() == b.Hash(); hashEqual != test.expected {
+				t.Errorf("Expected hashes to be equal: %t, got %t", test.expected, hashEqual)
+			}
+		})
+	}
+}
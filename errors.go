@@ -0,0 +1,103 @@
+package mango
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Reason is a machine-readable code describing why a selector could not be
+// parsed.
+type Reason string
+
+// Reasons a selector may fail to parse.
+const (
+	// ReasonInvalidJSON means that the input is not valid JSON.
+	ReasonInvalidJSON Reason = "invalid_json"
+	// ReasonInvalidSelector means that a selector, or the conditions for a
+	// field, are not a JSON object.
+	ReasonInvalidSelector Reason = "invalid_selector"
+	// ReasonInvalidOperator means that an operator is not recognized.
+	ReasonInvalidOperator Reason = "invalid_operator"
+	// ReasonBadArg means that the argument to an operator is invalid.
+	ReasonBadArg Reason = "bad_arg"
+	// ReasonMissingFieldName means that a condition operator was used
+	// where a field name is required.
+	ReasonMissingFieldName Reason = "missing_field_name"
+	// ReasonInvalidFieldName means that a field name is malformed, such as
+	// by containing an empty path component.
+	ReasonInvalidFieldName Reason = "invalid_field_name"
+)
+
+// ParseError is returned by New and Selector.UnmarshalJSON when a selector
+// cannot be parsed.
+type ParseError struct {
+	// Path is a JSON Pointer (RFC 6901) to the offending clause within the
+	// selector document. It is empty if the error concerns the whole
+	// document.
+	Path string
+	// Operator is the operator involved, such as "$regex", if any.
+	Operator string
+	// Reason categorizes the error.
+	Reason Reason
+	// Err is the underlying error.
+	Err error
+
+	// detail is the offending value, as reported by CouchDB: the operator's
+	// argument for ReasonBadArg, the field name for ReasonInvalidFieldName,
+	// and the selector for ReasonInvalidSelector.
+	detail interface{}
+}
+
+var _ error = &ParseError{}
+
+func parseError(reason Reason, op operator, detail interface{}, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Operator: string(op),
+		Reason:   reason,
+		Err:      fmt.Errorf(format, args...),
+		detail:   detail,
+	}
+}
+
+// badArg returns a ReasonBadArg error for op, which was passed arg.
+func badArg(op operator, arg interface{}, requirement string) *ParseError {
+	return parseError(ReasonBadArg, op, arg, "mango operator '%s' requires %s", op, requirement)
+}
+
+// rawValue decodes data, which must be valid JSON.
+func rawValue(data []byte) interface{} {
+	var v interface{}
+	_ = json.Unmarshal(data, &v)
+	return v
+}
+
+func (e *ParseError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+// StatusCode returns the HTTP status code CouchDB would respond with, which
+// is always 400 Bad Request.
+func (e *ParseError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// withPath prefixes the path of err, if it is a *ParseError, with the object
+// key or array index key.
+func withPath(err error, key string) error {
+	if perr, ok := err.(*ParseError); ok {
+		perr.Path = "/" + pointerEscaper.Replace(key) + perr.Path
+	}
+	return err
+}
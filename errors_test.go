@@ -0,0 +1,111 @@
+package mango
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestParseError(t *testing.T) {
+	type peTest struct {
+		name     string
+		input    string
+		expected ParseError
+	}
+	tests := []peTest{
+		{
+			name:  "invalid JSON",
+			input: `{"foo":`,
+			expected: ParseError{
+				Reason: ReasonInvalidJSON,
+			},
+		},
+		{
+			name:  "selector not an object",
+			input: `["foo"]`,
+			expected: ParseError{
+				Reason: ReasonInvalidSelector,
+			},
+		},
+		{
+			name:  "unknown operator",
+			input: `{"foo":{"$invalid":"bar"}}`,
+			expected: ParseError{
+				Path:     "/foo/$invalid",
+				Operator: "$invalid",
+				Reason:   ReasonInvalidOperator,
+			},
+		},
+		{
+			name:  "bad argument within $or",
+			input: `{"$or":[{"a":1},{"b":{"$in":"x"}}]}`,
+			expected: ParseError{
+				Path:     "/$or/1/b/$in",
+				Operator: "$in",
+				Reason:   ReasonBadArg,
+			},
+		},
+		{
+			name:  "non-object within $and",
+			input: `{"$and":[1]}`,
+			expected: ParseError{
+				Path:   "/$and/0",
+				Reason: ReasonInvalidSelector,
+			},
+		},
+		{
+			name:  "invalid regex",
+			input: `{"name":{"$regex":"(?=a)"}}`,
+			expected: ParseError{
+				Path:     "/name/$regex",
+				Operator: "$regex",
+				Reason:   ReasonBadArg,
+			},
+		},
+		{
+			name:  "missing field name",
+			input: `{"$not":{"$gt":1}}`,
+			expected: ParseError{
+				Path:     "/$not/$gt",
+				Operator: "$gt",
+				Reason:   ReasonMissingFieldName,
+			},
+		},
+		{
+			name:  "invalid field name",
+			input: `{"a/b~c":{"":1}}`,
+			expected: ParseError{
+				Path:   "/a~1b~0c/",
+				Reason: ReasonInvalidFieldName,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.input)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Expected *ParseError, got %T: %v", err, err)
+			}
+			if perr.Err == nil {
+				t.Error("Expected an underlying error")
+			}
+			result := *perr
+			result.Err = nil
+			result.detail = nil
+			if d := testy.DiffInterface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestParseErrorUnwrap(t *testing.T) {
+	_, err := New(`{"foo":`)
+	var serr *json.SyntaxError
+	if !errors.As(err, &serr) {
+		t.Errorf("Expected *json.SyntaxError, got %T", errors.Unwrap(err))
+	}
+}
@@ -0,0 +1,82 @@
+package mango
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// splitField splits a field name into the path of object keys or array
+// indices it refers to. Components are separated by periods; a period
+// preceded by a backslash is part of the key. Empty components are invalid.
+func splitField(field string) ([]string, error) {
+	var path []string
+	var current strings.Builder
+	for i := 0; i < len(field); i++ {
+		switch c := field[i]; {
+		case c == '\\' && i+1 < len(field) && field[i+1] == '.':
+			current.WriteByte('.')
+			i++
+		case c == '.':
+			path = append(path, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	path = append(path, current.String())
+	for _, name := range path {
+		if name == "" {
+			return nil, fmt.Errorf("invalid field name '%s'", field)
+		}
+	}
+	return path, nil
+}
+
+// escapeField escapes any periods in name, so that it is treated as a single
+// key by splitField.
+func escapeField(name string) string {
+	return strings.Replace(name, ".", `\.`, -1)
+}
+
+// joinField returns the field name referring to the key name within field.
+func joinField(field, name string) string {
+	if field == "" {
+		return escapeField(name)
+	}
+	return field + "." + escapeField(name)
+}
+
+type lookupStatus int
+
+const (
+	fieldFound lookupStatus = iota
+	// fieldNotFound means that an object along the path lacks the key.
+	fieldNotFound
+	// fieldBadPath means that the path traverses a value which is not an
+	// object, or an array index which is out of range.
+	fieldBadPath
+)
+
+// getField returns the value found by following path from v. As in CouchDB,
+// a numeric path component may index into an array.
+func getField(v interface{}, path []string) (interface{}, lookupStatus) {
+	for _, name := range path {
+		if obj, ok := v.(map[string]interface{}); ok {
+			if v, ok = obj[name]; !ok {
+				return nil, fieldNotFound
+			}
+			continue
+		}
+		elems, ok := arrayElements(v)
+		if !ok {
+			return nil, fieldBadPath
+		}
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 0 || i >= len(elems) {
+			return nil, fieldBadPath
+		}
+		v = elems[i]
+	}
+	return v, fieldFound
+}
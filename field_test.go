@@ -0,0 +1,191 @@
+package mango
+
+import (
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestSplitField(t *testing.T) {
+	type sfTest struct {
+		name     string
+		field    string
+		expected []string
+		err      string
+	}
+	tests := []sfTest{
+		{
+			name:     "simple",
+			field:    "foo",
+			expected: []string{"foo"},
+		},
+		{
+			name:     "nested",
+			field:    "address.city",
+			expected: []string{"address", "city"},
+		},
+		{
+			name:     "escaped period",
+			field:    `example\.com.visits`,
+			expected: []string{"example.com", "visits"},
+		},
+		{
+			name:     "other backslash",
+			field:    `a\b.c`,
+			expected: []string{`a\b`, "c"},
+		},
+		{
+			name:     "array index",
+			field:    "items.0.sku",
+			expected: []string{"items", "0", "sku"},
+		},
+		{
+			name:  "empty",
+			field: "",
+			err:   "invalid field name ''",
+		},
+		{
+			name:  "empty component",
+			field: "a..b",
+			err:   "invalid field name 'a..b'",
+		},
+		{
+			name:  "trailing period",
+			field: "a.",
+			err:   "invalid field name 'a.'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := splitField(test.field)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+			if d := testy.DiffInterface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestGetField(t *testing.T) {
+	doc := map[string]interface{}{
+		"name": "Bob",
+		"address": map[string]interface{}{
+			"city": "Boston",
+		},
+		"items": []interface{}{
+			map[string]interface{}{"sku": "a"},
+			map[string]interface{}{"sku": "b"},
+		},
+	}
+	type gfTest struct {
+		name     string
+		path     []string
+		expected interface{}
+		status   lookupStatus
+	}
+	tests := []gfTest{
+		{
+			name:     "empty path",
+			expected: doc,
+		},
+		{
+			name:     "top-level",
+			path:     []string{"name"},
+			expected: "Bob",
+		},
+		{
+			name:     "nested",
+			path:     []string{"address", "city"},
+			expected: "Boston",
+		},
+		{
+			name:   "missing",
+			path:   []string{"address", "zip"},
+			status: fieldNotFound,
+		},
+		{
+			name:   "into string",
+			path:   []string{"name", "first"},
+			status: fieldBadPath,
+		},
+		{
+			name:     "array index",
+			path:     []string{"items", "1", "sku"},
+			expected: "b",
+		},
+		{
+			name:   "array index out of range",
+			path:   []string{"items", "2", "sku"},
+			status: fieldBadPath,
+		},
+		{
+			name:   "non-numeric array index",
+			path:   []string{"items", "sku"},
+			status: fieldBadPath,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, status := getField(doc, test.path)
+			if status != test.status {
+				t.Errorf("Unexpected status: %d", status)
+			}
+			if d := testy.DiffInterface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestJoinField(t *testing.T) {
+	type jfTest struct {
+		name     string
+		field    string
+		key      string
+		expected string
+		path     []string
+	}
+	tests := []jfTest{
+		{
+			name:     "no parent",
+			key:      "foo",
+			expected: "foo",
+			path:     []string{"foo"},
+		},
+		{
+			name:     "parent",
+			field:    "foo",
+			key:      "bar",
+			expected: "foo.bar",
+			path:     []string{"foo", "bar"},
+		},
+		{
+			name:     "key containing a period",
+			field:    "sites",
+			key:      "example.com",
+			expected: `sites.example\.com`,
+			path:     []string{"sites", "example.com"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := joinField(test.field, test.key)
+			if result != test.expected {
+				t.Errorf("Unexpected result: %s", result)
+			}
+			path, err := splitField(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := testy.DiffInterface(test.path, path); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
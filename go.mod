@@ -2,4 +2,7 @@ module github.com/go-kivik/mango
 
 go 1.13
 
-require gitlab.com/flimzy/testy v0.1.1
+require (
+	gitlab.com/flimzy/testy v0.1.1
+	golang.org/x/text v0.13.0
+)
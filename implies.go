@@ -0,0 +1,159 @@
+package mango
+
+import (
+	"github.com/go-kivik/mango/collate"
+)
+
+// Implies returns true if every document matched by a is also matched by b,
+// as when a partial index with the selector b can serve a query with the
+// selector a.
+//
+// The analysis is conservative: a result of false means either that a does
+// not imply b, or that the implication could not be proven. It understands
+// equality, range, $in and $exists conditions, as well as the combination
+// operators, and compares values with raw collation, as by Matches; use a
+// Matcher to compare them with another collation.
+func Implies(a, b *Selector) bool {
+	return impliesWith(&collate.Raw{}, a, b)
+}
+
+// impliesWith returns true if a implies b, comparing values with c.
+func impliesWith(c collate.Collation, a, b *Selector) bool {
+	na, nb := normalize(c, *a), normalize(c, *b)
+	return implies(c, &na, &nb)
+}
+
+// implies returns true if a implies b, both of which are normalized.
+func implies(c collate.Collation, a, b *Selector) bool {
+	switch {
+	case b.op == opNone, a.isNever():
+		return true
+	case b.isNever():
+		return false
+	case b.op == opAnd:
+		for i := range b.sel {
+			if !implies(c, a, &b.sel[i]) {
+				return false
+			}
+		}
+		return true
+	case a.op == opOr:
+		for i := range a.sel {
+			if !implies(c, &a.sel[i], b) {
+				return false
+			}
+		}
+		return true
+	case a.Equal(b):
+		return true
+	}
+	switch b.op {
+	case opOr:
+		for i := range b.sel {
+			if implies(c, a, &b.sel[i]) {
+				return true
+			}
+		}
+	case opNot:
+		if disjoint(c, a, &b.sel[0]) {
+			return true
+		}
+	case opNor:
+		if disjointAll(c, a, b.sel) {
+			return true
+		}
+	}
+	if a.op == opAnd {
+		for i := range a.sel {
+			if implies(c, &a.sel[i], b) {
+				return true
+			}
+		}
+		return false
+	}
+	if a.Kind() == KindEmpty || a.Kind() == KindCombination || b.Kind() == KindCombination || a.field != b.field {
+		return false
+	}
+	return impliesCondition(c, a, b)
+}
+
+// disjointAll returns true if no document can match both a and any of sels.
+func disjointAll(c collate.Collation, a *Selector, sels []Selector) bool {
+	for i := range sels {
+		if !disjoint(c, a, &sels[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// disjoint returns true if no document can match both a and b.
+func disjoint(c collate.Collation, a, b *Selector) bool {
+	and := &Selector{
+		op:  opAnd,
+		sel: []Selector{*a, *b},
+	}
+	n := normalize(c, *and)
+	return n.isNever()
+}
+
+// impliesCondition returns true if the condition a implies the condition b,
+// on the same field.
+func impliesCondition(c collate.Collation, a, b *Selector) bool {
+	switch {
+	case b.op == opExists && b.value.(bool):
+		// Every condition other than $exists:false requires the field to
+		// exist.
+		return a.op != opExists || a.value.(bool)
+	case a.op == opEq:
+		// The field's value is known, so b can be evaluated against it.
+		cond := *b
+		cond.field = ""
+		m, _ := cond.match(c, a.value)
+		return m
+	case a.op == opIn && b.op == opIn:
+		for _, arg := range a.value.([]interface{}) {
+			if !contains(c, b.value.([]interface{}), arg) {
+				return false
+			}
+		}
+		return true
+	case isRange(a.op) && isRange(b.op):
+		return boundImplies(c, a, b)
+	case isRange(a.op) && b.op == opNE:
+		return !a.matchesValue(c, b.value)
+	case a.op == opElemMatch && b.op == opElemMatch,
+		a.op == opAllMatch && b.op == opAllMatch,
+		// $allMatch requires a non-empty array, so at least one element
+		// matches.
+		a.op == opAllMatch && b.op == opElemMatch:
+		return implies(c, &a.sel[0], &b.sel[0])
+	}
+	return false
+}
+
+func isRange(op operator) bool {
+	switch op {
+	case opGT, opGTE, opLT, opLTE:
+		return true
+	}
+	return false
+}
+
+// boundImplies returns true if the range condition a is at least as tight
+// as the range condition b.
+func boundImplies(c collate.Collation, a, b *Selector) bool {
+	lower := func(op operator) bool {
+		return op == opGT || op == opGTE
+	}
+	if lower(a.op) != lower(b.op) {
+		return false
+	}
+	if c.Eq(a.value, b.value) {
+		return a.op == b.op || a.op == opGT || a.op == opLT
+	}
+	if lower(a.op) {
+		return c.GT(a.value, b.value)
+	}
+	return c.LT(a.value, b.value)
+}
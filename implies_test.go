@@ -0,0 +1,64 @@
+package mango
+
+import "testing"
+
+func TestImplies(t *testing.T) {
+	type iTest struct {
+		name     string
+		a, b     string
+		expected bool
+	}
+	tests := []iTest{
+		{name: "anything implies empty", a: `{"a":1}`, b: `{}`, expected: true},
+		{name: "empty implies nothing", a: `{}`, b: `{"a":1}`},
+		{name: "identical", a: `{"a":1,"b":2}`, b: `{"b":2,"a":1}`, expected: true},
+		{name: "unsatisfiable implies anything", a: `{"a":{"$gt":5,"$lt":1}}`, b: `{"b":1}`, expected: true},
+		{name: "nothing implies unsatisfiable", a: `{"a":1}`, b: `{"a":{"$in":[]}}`},
+		{name: "$eq implies range", a: `{"a":5}`, b: `{"a":{"$gt":3}}`, expected: true},
+		{name: "$eq outside range", a: `{"a":2}`, b: `{"a":{"$gt":3}}`},
+		{name: "$eq implies $in", a: `{"a":"x"}`, b: `{"a":{"$in":["x","y"]}}`, expected: true},
+		{name: "$eq implies $ne", a: `{"a":1}`, b: `{"a":{"$ne":2}}`, expected: true},
+		{name: "$eq implies $type", a: `{"a":"x"}`, b: `{"a":{"$type":"string"}}`, expected: true},
+		{name: "$eq implies $regex", a: `{"a":"foo"}`, b: `{"a":{"$regex":"^f"}}`, expected: true},
+		{name: "$eq array implies $elemMatch", a: `{"a":[1,5]}`, b: `{"a":{"$elemMatch":{"$gt":4}}}`, expected: true},
+		{name: "$eq implies $exists", a: `{"a":null}`, b: `{"a":{"$exists":true}}`, expected: true},
+		{name: "$eq contradicts $exists false", a: `{"a":null}`, b: `{"a":{"$exists":false}}`},
+		{name: "different fields", a: `{"a":1}`, b: `{"b":1}`},
+		{name: "tighter lower bound", a: `{"a":{"$gt":5}}`, b: `{"a":{"$gte":3}}`, expected: true},
+		{name: "equal exclusive bound", a: `{"a":{"$gt":5}}`, b: `{"a":{"$gte":5}}`, expected: true},
+		{name: "equal inclusive bound", a: `{"a":{"$gte":5}}`, b: `{"a":{"$gt":5}}`},
+		{name: "looser upper bound", a: `{"a":{"$lt":10}}`, b: `{"a":{"$lt":5}}`},
+		{name: "range within range", a: `{"a":{"$gt":2,"$lt":4}}`, b: `{"a":{"$gt":1,"$lte":4}}`, expected: true},
+		{name: "range partially outside", a: `{"a":{"$gt":2,"$lt":6}}`, b: `{"a":{"$gt":1,"$lte":4}}`},
+		{name: "opposite bounds", a: `{"a":{"$gt":2}}`, b: `{"a":{"$lt":4}}`},
+		{name: "range excludes $ne", a: `{"a":{"$gt":2}}`, b: `{"a":{"$ne":1}}`, expected: true},
+		{name: "range collation", a: `{"a":{"$gt":"a"}}`, b: `{"a":{"$gt":100}}`, expected: true},
+		{name: "$in subset", a: `{"a":{"$in":[1,2]}}`, b: `{"a":{"$in":[3,2,1]}}`, expected: true},
+		{name: "$in superset", a: `{"a":{"$in":[1,4]}}`, b: `{"a":{"$in":[1,2]}}`},
+		{name: "$in does not imply range", a: `{"a":{"$in":[5]}}`, b: `{"a":{"$gt":1}}`},
+		{name: "condition implies $exists", a: `{"a":{"$type":"string"}}`, b: `{"a":{"$exists":true}}`, expected: true},
+		{name: "$exists false", a: `{"a":{"$exists":false}}`, b: `{"a":{"$exists":true}}`},
+		{name: "$and implies conjunct", a: `{"a":1,"b":2}`, b: `{"b":{"$gte":2}}`, expected: true},
+		{name: "$and implies $and", a: `{"a":1,"b":2,"c":3}`, b: `{"c":3,"a":{"$lt":2}}`, expected: true},
+		{name: "$and missing conjunct", a: `{"a":1}`, b: `{"a":1,"b":2}`},
+		{name: "disjunct implies $or", a: `{"a":1}`, b: `{"$or":[{"a":1},{"b":2}]}`, expected: true},
+		{name: "$or implies $or", a: `{"$or":[{"a":1},{"b":2}]}`, b: `{"$or":[{"b":{"$gt":1}},{"a":{"$lt":2}}]}`, expected: true},
+		{name: "$or does not imply disjunct", a: `{"$or":[{"a":1},{"b":2}]}`, b: `{"a":1}`},
+		{name: "$eq implies $not", a: `{"a":1}`, b: `{"$not":{"a":{"$gt":3}}}`, expected: true},
+		{name: "range implies $not", a: `{"a":{"$lt":1}}`, b: `{"a":{"$not":{"$gte":1}}}`, expected: true},
+		{name: "overlap does not imply $not", a: `{"a":{"$lt":5}}`, b: `{"$not":{"a":{"$gt":3}}}`},
+		{name: "$nor", a: `{"a":1}`, b: `{"$nor":[{"a":2},{"a":{"$exists":false}}]}`, expected: true},
+		{name: "$and implies its $not", a: `{"a":1,"$not":{"b":1}}`, b: `{"$not":{"b":1}}`, expected: true},
+		{name: "$and implies its $nor", a: `{"a":{"$in":[1,2]},"$nor":[{"a":1}]}`, b: `{"a":{"$in":[1,2]},"$nor":[{"a":1}]}`, expected: true},
+		{name: "$elemMatch", a: `{"a":{"$elemMatch":{"$gt":5}}}`, b: `{"a":{"$elemMatch":{"$gt":1}}}`, expected: true},
+		{name: "$allMatch implies $elemMatch", a: `{"a":{"$allMatch":{"b":1}}}`, b: `{"a":{"$elemMatch":{"b":{"$in":[1]}}}}`, expected: true},
+		{name: "$elemMatch does not imply $allMatch", a: `{"a":{"$elemMatch":{"b":1}}}`, b: `{"a":{"$allMatch":{"b":1}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := Implies(mustNew(test.a), mustNew(test.b)); result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
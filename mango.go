@@ -1,8 +1,14 @@
 package mango
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/go-kivik/mango/collate"
 )
@@ -14,120 +20,670 @@ type Selector struct {
 	field string
 	value interface{}
 	sel   []Selector
+	// re is the compiled pattern, for $regex.
+	re *regexp.Regexp
 }
 
-// New returns a new selector, parsed from data.
-func New(data string) (*Selector, error) {
+// New returns a new selector, parsed from data. Errors are returned as
+// *ParseError, unless the CouchDBErrors option is given.
+func New(data string, opts ...Option) (*Selector, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	s := &Selector{}
-	err := json.Unmarshal([]byte(data), &s)
+	err := s.UnmarshalJSON([]byte(data))
+	if perr, ok := err.(*ParseError); ok && o.couchDBErrors {
+		return s, perr.CouchDB()
+	}
 	return s, err
 }
 
 // UnmarshalJSON unmarshals a JSON selector as described in the CouchDB
-// documentation.
+// documentation. Errors are returned as *ParseError.
 // http://docs.couchdb.org/en/2.0.0/api/database/find.html#selector-syntax
 func (s *Selector) UnmarshalJSON(data []byte) error {
-	var x map[string]json.RawMessage
-	if err := json.Unmarshal(data, &x); err != nil {
+	sel, err := parseSelector(data, false)
+	if err != nil {
 		return err
 	}
-	if len(x) == 0 {
-		return nil
+	*s = sel
+	return nil
+}
+
+// MarshalJSON marshals the selector as canonical JSON, with every operator
+// explicit, and object keys in sorted order. Unmarshaling the result yields
+// a selector structurally identical to s.
+//
+// A condition on the array element itself, as built by Elem, has no JSON
+// representation outside of $elemMatch or $allMatch, and results in an
+// error.
+func (s Selector) MarshalJSON() ([]byte, error) {
+	v, err := s.jsonValue(false)
+	if err != nil {
+		return nil, err
 	}
-	var sels []Selector
-	for k, v := range x {
-		var op operator
-		var field string
-		var value interface{}
-		field = k
-		if v[0] == '{' {
-			var e error
-			op, value, e = opPattern(v)
-			if e != nil {
-				return e
+	return json.Marshal(v)
+}
+
+// jsonValue returns the selector as a value to be marshaled to JSON. elem is
+// true within $elemMatch and $allMatch, where a condition may apply to the
+// array element itself.
+func (s *Selector) jsonValue(elem bool) (interface{}, error) {
+	switch s.Kind() {
+	case KindEmpty:
+		return map[string]interface{}{}, nil
+	case KindCombination:
+		if s.op == opNot {
+			sel, err := s.sel[0].jsonValue(elem)
+			if err != nil {
+				return nil, err
 			}
+			return map[string]interface{}{string(s.op): sel}, nil
 		}
-		if op == "" {
-			op = opEq
-			if e := json.Unmarshal(v, &value); e != nil {
-				return e
+		sels := make([]interface{}, len(s.sel))
+		for i := range s.sel {
+			sel, err := s.sel[i].jsonValue(elem)
+			if err != nil {
+				return nil, err
 			}
+			sels[i] = sel
 		}
-		sels = append(sels, Selector{
-			op:    op,
-			field: field,
-			value: value,
-		})
+		return map[string]interface{}{string(s.op): sels}, nil
+	}
+	cond := map[string]interface{}{string(s.op): s.value}
+	if s.Kind() == KindField {
+		sel, err := s.sel[0].jsonValue(true)
+		if err != nil {
+			return nil, err
+		}
+		cond[string(s.op)] = sel
 	}
+	if s.field == "" {
+		if !elem {
+			return nil, fmt.Errorf("%s condition is missing a field name outside of $elemMatch or $allMatch", s.op)
+		}
+		// A condition on the array element itself, within $elemMatch or
+		// $allMatch.
+		return cond, nil
+	}
+	return map[string]interface{}{s.field: cond}, nil
+}
+
+// parseSelector parses a JSON selector object. Multiple keys are combined
+// with an implicit $and. params is true when parsing a Template, in which
+// values may be placeholders.
+func parseSelector(data []byte, params bool) (Selector, error) {
+	if !json.Valid(data) {
+		var x interface{}
+		return Selector{}, &ParseError{
+			Reason: ReasonInvalidJSON,
+			Err:    json.Unmarshal(data, &x),
+		}
+	}
+	return selectorPattern(data, false, params)
+}
+
+// selectorPattern parses a JSON selector object. elem is true within
+// $elemMatch and $allMatch, where condition operators may be used without a
+// field name, to apply to the array element itself.
+func selectorPattern(data []byte, elem, params bool) (Selector, error) {
+	sels, err := objectPattern(data, func(key string, data []byte) (Selector, error) {
+		return clausePattern(key, data, elem, params)
+	})
+	if err != nil || len(sels) == 0 {
+		return Selector{}, err
+	}
+	return and(sels), nil
+}
+
+// objectPattern parses each key of a JSON object with parse, in the order the
+// keys appear in data.
+func objectPattern(data []byte, parse func(key string, data []byte) (Selector, error)) ([]Selector, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '{' && !bytes.Equal(data, []byte("null")) {
+		return nil, parseError(ReasonInvalidSelector, opNone, rawValue(data), "mango selector must be an object")
+	}
+	members, err := objectMembers(data)
+	if err != nil {
+		return nil, &ParseError{Reason: ReasonInvalidJSON, Err: err}
+	}
+	var sels []Selector
+	for _, m := range members {
+		sel, err := parse(m.key, m.value)
+		if err != nil {
+			return nil, withPath(err, m.key)
+		}
+		sels = append(sels, sel)
+	}
+	return sels, nil
+}
+
+type member struct {
+	key   string
+	value json.RawMessage
+}
+
+// objectMembers decodes the members of a JSON object, or null, in source
+// order. As in CouchDB, only the last value of any duplicate key is kept.
+func objectMembers(data []byte) ([]member, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok == nil {
+		return nil, err
+	}
+	var members []member
+	index := make(map[string]int)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if i, ok := index[key]; ok {
+			members[i].value = value
+			continue
+		}
+		index[key] = len(members)
+		members = append(members, member{key: key, value: value})
+	}
+	return members, nil
+}
+
+// and combines sels with an implicit $and, unless there is only one.
+func and(sels []Selector) Selector {
 	if len(sels) == 1 {
-		*s = sels[0]
-	} else {
-		*s = Selector{
-			op:  opAnd,
-			sel: sels,
+		return sels[0]
+	}
+	return Selector{
+		op:  opAnd,
+		sel: sels,
+	}
+}
+
+// clausePattern parses a single key of a selector object, which is either an
+// operator or a field name. A condition operator with no field name applies
+// to the value being matched, which is only permitted within $elemMatch and
+// $allMatch.
+func clausePattern(key string, data []byte, elem, params bool) (Selector, error) {
+	parse := func(data []byte) (Selector, error) {
+		return selectorPattern(data, elem, params)
+	}
+	switch op := operator(key); op {
+	case opAnd, opOr, opNor:
+		return combinationPattern(op, data, parse)
+	case opNot:
+		return notPattern(data, parse)
+	}
+	if !strings.HasPrefix(key, "$") {
+		return fieldPattern(key, data, params)
+	}
+	sel, err := conditionPattern("", operator(key), data, params)
+	if err != nil {
+		return Selector{}, err
+	}
+	if !elem {
+		return Selector{}, parseError(ReasonMissingFieldName, operator(key), nil, "one or more conditions is missing a field name")
+	}
+	return sel, nil
+}
+
+// combinationPattern parses the argument to a combination operator, which
+// must be an array of selectors, each of which is parsed with parse.
+func combinationPattern(op operator, data []byte, parse func([]byte) (Selector, error)) (Selector, error) {
+	if data[0] != '[' {
+		return Selector{}, badArg(op, rawValue(data), "an array argument")
+	}
+	var x []json.RawMessage
+	if err := json.Unmarshal(data, &x); err != nil {
+		return Selector{}, &ParseError{Operator: string(op), Reason: ReasonInvalidJSON, Err: err}
+	}
+	var sels []Selector
+	for i, v := range x {
+		sel, err := parse(v)
+		if err != nil {
+			return Selector{}, withPath(err, strconv.Itoa(i))
 		}
+		sels = append(sels, sel)
 	}
-	return nil
+	return Selector{
+		op:  op,
+		sel: sels,
+	}, nil
 }
 
-func opPattern(data []byte) (op operator, value interface{}, err error) {
-	var x map[operator]json.RawMessage
-	if e := json.Unmarshal(data, &x); e != nil {
-		return operator(""), nil, e
+// notPattern parses the argument to $not, which must be an object. parse
+// is used to parse the object itself, so that $not may be used both at the
+// top level and within a field.
+func notPattern(data []byte, parse func([]byte) (Selector, error)) (Selector, error) {
+	if data[0] != '{' {
+		return Selector{}, badArg(opNot, rawValue(data), "an object argument")
+	}
+	sel, err := parse(data)
+	if err != nil {
+		return Selector{}, err
+	}
+	return Selector{
+		op:  opNot,
+		sel: []Selector{sel},
+	}, nil
+}
+
+// fieldPattern parses the condition applied to field. A bare value, or a
+// placeholder, is an implicit $eq.
+func fieldPattern(field string, data []byte, params bool) (Selector, error) {
+	if _, err := splitField(field); err != nil {
+		return Selector{}, &ParseError{Reason: ReasonInvalidFieldName, Err: err, detail: field}
+	}
+	if params && isPlaceholder(rawValue(data)) {
+		return conditionPattern(field, opEq, data, params)
 	}
-	if len(x) != 1 {
-		panic("got more than one result")
+	if data[0] == '{' {
+		return opPattern(field, data, params)
 	}
-	for k, v := range x {
-		switch k {
-		case opEq, opNE, opLT, opLTE, opGT, opGTE:
-			var value interface{}
-			if e := json.Unmarshal(v, &value); e != nil {
-				return "", nil, e
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return Selector{}, &ParseError{Reason: ReasonInvalidJSON, Err: err}
+	}
+	return Selector{
+		op:    opEq,
+		field: field,
+		value: value,
+	}, nil
+}
+
+// opPattern parses an object of conditions applied to field. Multiple
+// conditions are combined with an implicit $and.
+func opPattern(field string, data []byte, params bool) (Selector, error) {
+	sels, err := objectPattern(data, func(key string, data []byte) (Selector, error) {
+		if !strings.HasPrefix(key, "$") {
+			// A nested object is shorthand for conditions on its fields, so
+			// {"imdb":{"rating":8}} is equivalent to {"imdb.rating":8}.
+			return fieldPattern(joinField(field, key), data, params)
+		}
+		return conditionPattern(field, operator(key), data, params)
+	})
+	if err != nil {
+		return Selector{}, err
+	}
+	if len(sels) == 0 {
+		// CouchDB treats an empty object of conditions as matching any
+		// value, so the field need only exist.
+		return Selector{
+			op:    opExists,
+			field: field,
+			value: true,
+		}, nil
+	}
+	return and(sels), nil
+}
+
+// conditionPattern parses a single operator and its argument, as applied to
+// field.
+func conditionPattern(field string, op operator, data []byte, params bool) (Selector, error) {
+	switch op {
+	case opEq, opNE, opLT, opLTE, opGT, opGTE, opIn, opNIn, opAll, opExists, opType, opSize, opMod, opRegex:
+		var value interface{}
+		if e := json.Unmarshal(data, &value); e != nil {
+			return Selector{}, &ParseError{Operator: string(op), Reason: ReasonInvalidJSON, Err: e}
+		}
+		if params {
+			var found bool
+			var err error
+			if value, found, err = placeholders(value); err != nil {
+				return Selector{}, err
 			}
-			return k, value, nil
-		default:
-			return "", nil, fmt.Errorf("unknown mango operator '%s'", k)
+			if found {
+				// The argument is validated once the template is bound.
+				return Selector{
+					op:    op,
+					field: field,
+					value: value,
+				}, nil
+			}
+		}
+		return newCondition(field, op, value)
+	case opAnd, opOr, opNor:
+		return combinationPattern(op, data, func(data []byte) (Selector, error) {
+			if data[0] != '{' {
+				return Selector{}, badArg(op, rawValue(data), "an array of objects")
+			}
+			return opPattern(field, data, params)
+		})
+	case opNot:
+		return notPattern(data, func(data []byte) (Selector, error) {
+			return opPattern(field, data, params)
+		})
+	case opElemMatch, opAllMatch:
+		if data[0] != '{' {
+			return Selector{}, badArg(op, rawValue(data), "an object argument")
+		}
+		sel, err := selectorPattern(data, true, params)
+		if err != nil {
+			return Selector{}, err
+		}
+		return Selector{
+			op:    op,
+			field: field,
+			sel:   []Selector{sel},
+		}, nil
+	}
+	return Selector{}, parseError(ReasonInvalidOperator, op, nil, "unknown mango operator '%s'", op)
+}
+
+// newCondition returns a condition selector for op applied to field, after
+// validating value as an argument to op.
+func newCondition(field string, op operator, value interface{}) (Selector, error) {
+	switch op {
+	case opIn, opNIn, opAll:
+		if _, ok := value.([]interface{}); !ok {
+			return Selector{}, badArg(op, value, "an array argument")
+		}
+	case opExists:
+		if _, ok := value.(bool); !ok {
+			return Selector{}, badArg(op, value, "a boolean argument")
+		}
+	case opType:
+		if _, ok := value.(string); !ok {
+			return Selector{}, badArg(op, value, "a string argument")
+		}
+	case opSize:
+		if n, ok := toInteger(value); !ok || n < 0 {
+			return Selector{}, badArg(op, value, "a non-negative integer argument")
+		}
+	case opMod:
+		args, _ := value.([]interface{})
+		if len(args) != 2 {
+			return Selector{}, badArg(op, value, "an argument of the form [divisor, remainder]")
+		}
+		divisor, ok := toInteger(args[0])
+		if !ok || divisor < 1 {
+			return Selector{}, badArg(op, args[0], "a positive integer divisor")
+		}
+		if _, ok := toInteger(args[1]); !ok {
+			return Selector{}, badArg(op, value, "an integer remainder")
+		}
+	case opRegex:
+		pattern, ok := value.(string)
+		if !ok {
+			return Selector{}, badArg(op, value, "a string argument")
+		}
+		re, err := compileRegex(pattern)
+		if err != nil {
+			return Selector{}, &ParseError{Operator: string(op), Reason: ReasonBadArg, Err: err, detail: value}
 		}
+		return Selector{
+			op:    op,
+			field: field,
+			value: value,
+			re:    re,
+		}, nil
 	}
-	return operator(""), nil, nil
+	return Selector{
+		op:    op,
+		field: field,
+		value: value,
+	}, nil
 }
 
 type couchDoc map[string]interface{}
 
-// Matches returns true if the provided doc matches the selector.
+// Matches returns true if the provided doc matches the selector. Values are
+// compared with raw collation; use a Matcher to compare them with another
+// collation.
 func (s *Selector) Matches(doc couchDoc) (bool, error) {
-	c := &collate.Raw{}
+	return s.match(&collate.Raw{}, map[string]interface{}(doc))
+}
+
+// fieldValue returns the value of s's field within v, and whether it exists.
+func (s *Selector) fieldValue(v interface{}) (interface{}, bool) {
+	fv, status := s.lookup(v)
+	return fv, status == fieldFound
+}
+
+// lookup returns the value of s's field within v. An empty field refers to v
+// itself.
+func (s *Selector) lookup(v interface{}) (interface{}, lookupStatus) {
+	if s.field == "" {
+		return v, fieldFound
+	}
+	path, err := splitField(s.field)
+	if err != nil {
+		return nil, fieldBadPath
+	}
+	return getField(v, path)
+}
+
+// match returns true if v matches the selector, comparing values with c. v
+// is the document, or an array element when evaluating $elemMatch or
+// $allMatch.
+func (s *Selector) match(c collate.Collation, v interface{}) (bool, error) {
 	switch s.op {
 	case opNone:
 		return true, nil
-	case opEq, opGT, opGTE, opLT, opLTE:
-		v, ok := doc[s.field]
+	case opEq, opNE, opGT, opGTE, opLT, opLTE:
+		fv, ok := s.fieldValue(v)
 		if !ok {
 			return false, nil
 		}
 		switch s.op {
 		case opEq:
-			return c.Eq(v, s.value), nil
+			return c.Eq(fv, s.value), nil
+		case opNE:
+			return !c.Eq(fv, s.value), nil
 		case opGT:
-			return c.GT(v, s.value), nil
+			return c.GT(fv, s.value), nil
 		case opGTE:
-			return c.GTE(v, s.value), nil
+			return c.GTE(fv, s.value), nil
 		case opLT:
-			return c.LT(v, s.value), nil
+			return c.LT(fv, s.value), nil
 		case opLTE:
-			return c.LTE(v, s.value), nil
+			return c.LTE(fv, s.value), nil
+		}
+	case opExists:
+		_, status := s.lookup(v)
+		if s.value.(bool) {
+			return status == fieldFound, nil
+		}
+		// As in CouchDB, a path which cannot be followed, such as into a
+		// string, is not considered missing.
+		return status == fieldNotFound, nil
+	case opType:
+		fv, ok := s.fieldValue(v)
+		if !ok {
+			return false, nil
+		}
+		return collate.TypeName(fv) == s.value.(string), nil
+	case opRegex:
+		fv, _ := s.fieldValue(v)
+		str, ok := fv.(string)
+		if !ok {
+			return false, nil
+		}
+		return matchRegex(s.re, str), nil
+	case opSize:
+		fv, _ := s.fieldValue(v)
+		elems, ok := arrayElements(fv)
+		if !ok {
+			return false, nil
+		}
+		n, _ := toInteger(s.value)
+		return float64(len(elems)) == n, nil
+	case opMod:
+		fv, _ := s.fieldValue(v)
+		n, ok := toInteger(fv)
+		if !ok {
+			return false, nil
+		}
+		args := s.value.([]interface{})
+		divisor, _ := toInteger(args[0])
+		remainder, _ := toInteger(args[1])
+		// math.Mod truncates, like Erlang's rem, so the sign of the result
+		// follows the dividend.
+		return math.Mod(n, divisor) == remainder, nil
+	case opIn, opNIn, opAll:
+		fv, ok := s.fieldValue(v)
+		if !ok {
+			return false, nil
+		}
+		args := s.value.([]interface{})
+		switch s.op {
+		case opIn:
+			return in(c, fv, args), nil
+		case opNIn:
+			return !in(c, fv, args), nil
+		case opAll:
+			return all(c, fv, args), nil
+		}
+	case opElemMatch, opAllMatch:
+		fv, _ := s.fieldValue(v)
+		elems, ok := arrayElements(fv)
+		if !ok || len(elems) == 0 {
+			return false, nil
+		}
+		for _, elem := range elems {
+			m, e := s.sel[0].match(c, elem)
+			if e != nil {
+				return false, e
+			}
+			if m == (s.op == opElemMatch) {
+				return m, nil
+			}
 		}
+		return s.op == opAllMatch, nil
 	case opAnd:
 		for _, sel := range s.sel {
-			m, e := sel.Matches(doc)
+			m, e := sel.match(c, v)
 			if e != nil || !m {
 				return m, e
 			}
 		}
 		return true, nil
+	case opOr:
+		// CouchDB treats an empty $or as matching everything.
+		if len(s.sel) == 0 {
+			return true, nil
+		}
+		for _, sel := range s.sel {
+			m, e := sel.match(c, v)
+			if e != nil || m {
+				return m, e
+			}
+		}
+		return false, nil
+	case opNot:
+		// A missing field fails the inner condition, so $not matches, as in
+		// CouchDB.
+		m, e := s.sel[0].match(c, v)
+		if e != nil {
+			return false, e
+		}
+		return !m, nil
+	case opNor:
+		for _, sel := range s.sel {
+			m, e := sel.match(c, v)
+			if e != nil {
+				return false, e
+			}
+			if m {
+				return false, nil
+			}
+		}
+		return true, nil
 	default:
 		return false, fmt.Errorf("unknown mango operator '%s'", s.op)
 	}
 	return true, nil
 }
+
+// arrayElements returns the elements of v, if v is an array.
+func arrayElements(v interface{}) ([]interface{}, bool) {
+	if a, ok := v.([]interface{}); ok {
+		return a, true
+	}
+	if v == nil {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+	default:
+		return nil, false
+	}
+	elems := make([]interface{}, rv.Len())
+	for i := range elems {
+		elems[i] = rv.Index(i).Interface()
+	}
+	return elems, true
+}
+
+// contains returns true if any element of values is equal to v.
+func contains(c collate.Collation, values []interface{}, v interface{}) bool {
+	for _, value := range values {
+		if c.Eq(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// in returns true if v is equal to one of args. If v is an array, it is
+// sufficient for any of its elements to be equal to one of args.
+func in(c collate.Collation, v interface{}, args []interface{}) bool {
+	if elems, ok := arrayElements(v); ok {
+		for _, elem := range elems {
+			if contains(c, args, elem) {
+				return true
+			}
+		}
+		return false
+	}
+	return contains(c, args, v)
+}
+
+// all returns true if v is an array containing every one of args. As in
+// CouchDB, an argument consisting of a single array also matches if it is
+// equal to v, and an empty argument matches nothing.
+func all(c collate.Collation, v interface{}, args []interface{}) bool {
+	elems, ok := arrayElements(v)
+	if !ok || len(args) == 0 {
+		return false
+	}
+	if len(args) == 1 {
+		if _, isArray := arrayElements(args[0]); isArray && c.Eq(args[0], v) {
+			return true
+		}
+	}
+	for _, arg := range args {
+		if !contains(c, elems, arg) {
+			return false
+		}
+	}
+	return true
+}
+
+// toInteger returns v as a float64, if v is a number with no fractional part.
+// JSON numbers are decoded as float64, so 5 and 5.0 cannot be distinguished,
+// and both are treated as integers.
+func toInteger(v interface{}) (float64, bool) {
+	var f float64
+	switch t := v.(type) {
+	case float64:
+		f = t
+	case float32:
+		f = float64(t)
+	case int, int8, int16, int32, int64:
+		return float64(reflect.ValueOf(t).Int()), true
+	case uint, uint8, uint16, uint32, uint64:
+		return float64(reflect.ValueOf(t).Uint()), true
+	default:
+		return 0, false
+	}
+	if math.IsInf(f, 0) || f != math.Trunc(f) {
+		return 0, false
+	}
+	return f, true
+}
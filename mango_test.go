@@ -1,21 +1,14 @@
 package mango
 
 import (
+	"encoding/json"
 	"fmt"
-	"sort"
+	"regexp"
 	"testing"
 
 	"gitlab.com/flimzy/testy"
 )
 
-type Selectors []Selector
-
-var _ sort.Interface = &Selectors{}
-
-func (s Selectors) Len() int           { return len(s) }
-func (s Selectors) Less(i, j int) bool { return s[i].field < s[j].field }
-func (s Selectors) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-
 func TestUnmarshal(t *testing.T) {
 	type uTest struct {
 		name     string
@@ -32,7 +25,7 @@ func TestUnmarshal(t *testing.T) {
 		{
 			name:  "Invalid operator",
 			input: `{"foo":{"$invalid":"bar"}}`,
-			err:   "unknown mango operator '$invalid'",
+			err:   "/foo/$invalid: unknown mango operator '$invalid'",
 		},
 		{
 			name:  "invalid JSON",
@@ -52,11 +45,44 @@ func TestUnmarshal(t *testing.T) {
 			expected: Selector{
 				op: opAnd,
 				sel: []Selector{
-					{op: opEq, field: "location", value: "Boston"},
 					{op: opEq, field: "name", value: "Paul"},
+					{op: opEq, field: "location", value: "Boston"},
+				},
+			},
+		},
+		{
+			name:  "source order of conditions",
+			input: `{"z":{"$lt":5,"$gt":1},"a":1}`,
+			expected: Selector{
+				op: opAnd,
+				sel: []Selector{
+					{
+						op: opAnd,
+						sel: []Selector{
+							{op: opLT, field: "z", value: float64(5)},
+							{op: opGT, field: "z", value: float64(1)},
+						},
+					},
+					{op: opEq, field: "a", value: float64(1)},
 				},
 			},
 		},
+		{
+			name:  "duplicate keys",
+			input: `{"a":1,"b":2,"a":3}`,
+			expected: Selector{
+				op: opAnd,
+				sel: []Selector{
+					{op: opEq, field: "a", value: float64(3)},
+					{op: opEq, field: "b", value: float64(2)},
+				},
+			},
+		},
+		{
+			name:  "first error in source order",
+			input: `{"b":{"$bad":1},"a":{"$worse":1}}`,
+			err:   "/b/$bad: unknown mango operator '$bad'",
+		},
 		{
 			name:     "explicit $eq",
 			input:    `{"director":{"$eq":"Lars von Trier"}}`,
@@ -87,16 +113,404 @@ func TestUnmarshal(t *testing.T) {
 			input:    `{"_id":{"$gt":null}}`,
 			expected: Selector{op: opGT, field: "_id", value: nil},
 		},
-		// {
-		// 	// http://docs.couchdb.org/en/2.0.0/api/database/find.html#subfields
-		// 	name:  "subfields 1",
-		// 	input: `{"imdb": {"rating": 8}}`,
-		// 	expected: Selector{
-		// 		op:      opEq,
-		// 		field:   "imdb.rating",
-		// 		pattern: []byte("8"),
-		// 	},
-		// },
+		{
+			// http://docs.couchdb.org/en/2.0.0/api/database/find.html#the-or-operator
+			name:  "$or",
+			input: `{"$or":[{"director":"George Lucas"},{"director":"Steven Spielberg"}]}`,
+			expected: Selector{
+				op: opOr,
+				sel: []Selector{
+					{op: opEq, field: "director", value: "George Lucas"},
+					{op: opEq, field: "director", value: "Steven Spielberg"},
+				},
+			},
+		},
+		{
+			name:  "$nor",
+			input: `{"$nor":[{"year":1901},{"year":{"$gt":1905}}]}`,
+			expected: Selector{
+				op: opNor,
+				sel: []Selector{
+					{op: opEq, field: "year", value: float64(1901)},
+					{op: opGT, field: "year", value: float64(1905)},
+				},
+			},
+		},
+		{
+			name:  "explicit $and",
+			input: `{"$and":[{"_id":{"$gt":null}},{"year":2001}]}`,
+			expected: Selector{
+				op: opAnd,
+				sel: []Selector{
+					{op: opGT, field: "_id", value: nil},
+					{op: opEq, field: "year", value: float64(2001)},
+				},
+			},
+		},
+		{
+			name:  "nested $or in $and",
+			input: `{"$and":[{"$or":[{"a":1},{"b":2}]},{"$nor":[{"c":3}]}]}`,
+			expected: Selector{
+				op: opAnd,
+				sel: []Selector{
+					{
+						op: opOr,
+						sel: []Selector{
+							{op: opEq, field: "a", value: float64(1)},
+							{op: opEq, field: "b", value: float64(2)},
+						},
+					},
+					{
+						op: opNor,
+						sel: []Selector{
+							{op: opEq, field: "c", value: float64(3)},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "empty $or",
+			input:    `{"$or":[]}`,
+			expected: Selector{op: opOr},
+		},
+		{
+			name:  "$or with non-array argument",
+			input: `{"$or":{"a":1}}`,
+			err:   "/$or: mango operator '$or' requires an array argument",
+		},
+		{
+			name:  "unknown top-level operator",
+			input: `{"$invalid":[]}`,
+			err:   "/$invalid: unknown mango operator '$invalid'",
+		},
+		{
+			name:  "top-level $not",
+			input: `{"$not":{"year":1901}}`,
+			expected: Selector{
+				op: opNot,
+				sel: []Selector{
+					{op: opEq, field: "year", value: float64(1901)},
+				},
+			},
+		},
+		{
+			name:  "field $not",
+			input: `{"year":{"$not":{"$gt":1905}}}`,
+			expected: Selector{
+				op: opNot,
+				sel: []Selector{
+					{op: opGT, field: "year", value: float64(1905)},
+				},
+			},
+		},
+		{
+			name:  "double field $not",
+			input: `{"year":{"$not":{"$not":{"$eq":1905}}}}`,
+			expected: Selector{
+				op: opNot,
+				sel: []Selector{
+					{
+						op: opNot,
+						sel: []Selector{
+							{op: opEq, field: "year", value: float64(1905)},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "$not with non-object argument",
+			input: `{"$not":[{"year":1901}]}`,
+			err:   "/$not: mango operator '$not' requires an object argument",
+		},
+		{
+			name:  "field $not with non-object argument",
+			input: `{"year":{"$not":1901}}`,
+			err:   "/year/$not: mango operator '$not' requires an object argument",
+		},
+		{
+			// http://docs.couchdb.org/en/2.0.0/api/database/find.html#combination-operators
+			name:  "$elemMatch",
+			input: `{"genre":{"$elemMatch":{"$eq":"Horror"}}}`,
+			expected: Selector{
+				op:    opElemMatch,
+				field: "genre",
+				sel: []Selector{
+					{op: opEq, value: "Horror"},
+				},
+			},
+		},
+		{
+			name:  "$allMatch with fields",
+			input: `{"items":{"$allMatch":{"qty":{"$gt":0}}}}`,
+			expected: Selector{
+				op:    opAllMatch,
+				field: "items",
+				sel: []Selector{
+					{op: opGT, field: "qty", value: float64(0)},
+				},
+			},
+		},
+		{
+			name:  "nested $elemMatch",
+			input: `{"items":{"$elemMatch":{"$or":[{"sku":"a"},{"tags":{"$elemMatch":{"$eq":"sale"}}}]}}}`,
+			expected: Selector{
+				op:    opElemMatch,
+				field: "items",
+				sel: []Selector{
+					{
+						op: opOr,
+						sel: []Selector{
+							{op: opEq, field: "sku", value: "a"},
+							{
+								op:    opElemMatch,
+								field: "tags",
+								sel: []Selector{
+									{op: opEq, value: "sale"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:  "$elemMatch with non-object argument",
+			input: `{"genre":{"$elemMatch":"Horror"}}`,
+			err:   "/genre/$elemMatch: mango operator '$elemMatch' requires an object argument",
+		},
+		{
+			name:  "top-level condition",
+			input: `{"$gt":1}`,
+			err:   "/$gt: one or more conditions is missing a field name",
+		},
+		{
+			name:  "top-level $elemMatch",
+			input: `{"$or":[{"$elemMatch":{"a":1}}]}`,
+			err:   "/$or/0/$elemMatch: one or more conditions is missing a field name",
+		},
+		{
+			name:     "$in",
+			input:    `{"status":{"$in":["a","b"]}}`,
+			expected: Selector{op: opIn, field: "status", value: []interface{}{"a", "b"}},
+		},
+		{
+			name:     "$nin",
+			input:    `{"year":{"$nin":[1990,1991]}}`,
+			expected: Selector{op: opNIn, field: "year", value: []interface{}{float64(1990), float64(1991)}},
+		},
+		{
+			name:     "$all",
+			input:    `{"tags":{"$all":["x","y"]}}`,
+			expected: Selector{op: opAll, field: "tags", value: []interface{}{"x", "y"}},
+		},
+		{
+			name:  "$in with non-array argument",
+			input: `{"status":{"$in":"a"}}`,
+			err:   "/status/$in: mango operator '$in' requires an array argument",
+		},
+		{
+			name:  "$all with non-array argument",
+			input: `{"tags":{"$all":{"x":"y"}}}`,
+			err:   "/tags/$all: mango operator '$all' requires an array argument",
+		},
+		{
+			name:     "$exists",
+			input:    `{"year":{"$exists":false}}`,
+			expected: Selector{op: opExists, field: "year", value: false},
+		},
+		{
+			name:     "$type",
+			input:    `{"year":{"$type":"number"}}`,
+			expected: Selector{op: opType, field: "year", value: "number"},
+		},
+		{
+			name:  "$exists with non-boolean argument",
+			input: `{"year":{"$exists":"yes"}}`,
+			err:   "/year/$exists: mango operator '$exists' requires a boolean argument",
+		},
+		{
+			name:  "$type with non-string argument",
+			input: `{"year":{"$type":1}}`,
+			err:   "/year/$type: mango operator '$type' requires a string argument",
+		},
+		{
+			name:     "$size",
+			input:    `{"tags":{"$size":2}}`,
+			expected: Selector{op: opSize, field: "tags", value: float64(2)},
+		},
+		{
+			name:  "$size negative",
+			input: `{"tags":{"$size":-1}}`,
+			err:   "/tags/$size: mango operator '$size' requires a non-negative integer argument",
+		},
+		{
+			name:  "$size fractional",
+			input: `{"tags":{"$size":1.5}}`,
+			err:   "/tags/$size: mango operator '$size' requires a non-negative integer argument",
+		},
+		{
+			name:     "$mod",
+			input:    `{"year":{"$mod":[4,0]}}`,
+			expected: Selector{op: opMod, field: "year", value: []interface{}{float64(4), float64(0)}},
+		},
+		{
+			name:  "$mod non-array",
+			input: `{"year":{"$mod":4}}`,
+			err:   "/year/$mod: mango operator '$mod' requires an argument of the form [divisor, remainder]",
+		},
+		{
+			name:  "$mod too many arguments",
+			input: `{"year":{"$mod":[4,0,1]}}`,
+			err:   "/year/$mod: mango operator '$mod' requires an argument of the form [divisor, remainder]",
+		},
+		{
+			name:  "$mod zero divisor",
+			input: `{"year":{"$mod":[0,0]}}`,
+			err:   "/year/$mod: mango operator '$mod' requires a positive integer divisor",
+		},
+		{
+			name:  "$mod fractional divisor",
+			input: `{"year":{"$mod":[1.5,0]}}`,
+			err:   "/year/$mod: mango operator '$mod' requires a positive integer divisor",
+		},
+		{
+			name:  "$mod string remainder",
+			input: `{"year":{"$mod":[4,"0"]}}`,
+			err:   "/year/$mod: mango operator '$mod' requires an integer remainder",
+		},
+		{
+			name:     "$regex",
+			input:    `{"name":{"$regex":"^A"}}`,
+			expected: Selector{op: opRegex, field: "name", value: "^A", re: mustCompileRegex("^A")},
+		},
+		{
+			name:  "$regex with non-string argument",
+			input: `{"name":{"$regex":1}}`,
+			err:   "/name/$regex: mango operator '$regex' requires a string argument",
+		},
+		{
+			name:  "$regex with unsupported pattern",
+			input: `{"name":{"$regex":"(a)\\1"}}`,
+			err:   "/name/$regex: invalid $regex pattern: backreferences are not supported: `\\1`",
+		},
+		{
+			name:     "dotted field",
+			input:    `{"imdb.rating":{"$gt":7}}`,
+			expected: Selector{op: opGT, field: "imdb.rating", value: float64(7)},
+		},
+		{
+			name:  "invalid field name",
+			input: `{"imdb..rating":8}`,
+			err:   "/imdb..rating: invalid field name 'imdb..rating'",
+		},
+		{
+			// http://docs.couchdb.org/en/2.0.0/api/database/find.html#subfields
+			name:     "subfields 1",
+			input:    `{"imdb": {"rating": 8}}`,
+			expected: Selector{op: opEq, field: "imdb.rating", value: float64(8)},
+		},
+		{
+			name:     "subfields with operator",
+			input:    `{"imdb": {"rating": {"$gt": 7}}}`,
+			expected: Selector{op: opGT, field: "imdb.rating", value: float64(7)},
+		},
+		{
+			name:     "deeply nested subfields",
+			input:    `{"a": {"b": {"c": {"$exists": true}}}}`,
+			expected: Selector{op: opExists, field: "a.b.c", value: true},
+		},
+		{
+			name:     "subfield containing a period",
+			input:    `{"sites": {"example.com": {"$gte": 10}}}`,
+			expected: Selector{op: opGTE, field: `sites.example\.com`, value: float64(10)},
+		},
+		{
+			name:  "subfield under $not",
+			input: `{"imdb": {"$not": {"rating": 8}}}`,
+			expected: Selector{
+				op: opNot,
+				sel: []Selector{
+					{op: opEq, field: "imdb.rating", value: float64(8)},
+				},
+			},
+		},
+		{
+			name:  "subfield with $elemMatch",
+			input: `{"order": {"items": {"$elemMatch": {"sku": "a"}}}}`,
+			expected: Selector{
+				op:    opElemMatch,
+				field: "order.items",
+				sel: []Selector{
+					{op: opEq, field: "sku", value: "a"},
+				},
+			},
+		},
+		{
+			name:  "range",
+			input: `{"year":{"$gte":1990,"$lt":2000}}`,
+			expected: Selector{
+				op: opAnd,
+				sel: []Selector{
+					{op: opGTE, field: "year", value: float64(1990)},
+					{op: opLT, field: "year", value: float64(2000)},
+				},
+			},
+		},
+		{
+			name:  "operator and subfield",
+			input: `{"imdb":{"$exists":true,"rating":8}}`,
+			expected: Selector{
+				op: opAnd,
+				sel: []Selector{
+					{op: opExists, field: "imdb", value: true},
+					{op: opEq, field: "imdb.rating", value: float64(8)},
+				},
+			},
+		},
+		{
+			name:     "empty condition",
+			input:    `{"imdb":{}}`,
+			expected: Selector{op: opExists, field: "imdb", value: true},
+		},
+		{
+			name:  "field $or",
+			input: `{"year":{"$or":[{"$gt":2000},{"$lt":1990}]}}`,
+			expected: Selector{
+				op: opOr,
+				sel: []Selector{
+					{op: opGT, field: "year", value: float64(2000)},
+					{op: opLT, field: "year", value: float64(1990)},
+				},
+			},
+		},
+		{
+			name:  "field $and",
+			input: `{"year":{"$and":[{"$gte":1990},{"$lt":2000}]}}`,
+			expected: Selector{
+				op: opAnd,
+				sel: []Selector{
+					{op: opGTE, field: "year", value: float64(1990)},
+					{op: opLT, field: "year", value: float64(2000)},
+				},
+			},
+		},
+		{
+			name:  "field $or with non-object",
+			input: `{"year":{"$or":[1990]}}`,
+			err:   "/year/$or/0: mango operator '$or' requires an array of objects",
+		},
+		{
+			name:  "multiple operators, one invalid",
+			input: `{"year":{"$gte":1990,"$invalid":2000}}`,
+			err:   "/year/$invalid: unknown mango operator '$invalid'",
+		},
+		{
+			name:  "empty subfield name",
+			input: `{"imdb": {"": 8}}`,
+			err:   "/imdb/: invalid field name 'imdb.'",
+		},
 	}
 	for _, op := range []operator{opLT, opLTE, opEq, opNE, opGTE, opGT} {
 		tests = append(tests, uTest{
@@ -124,7 +538,17 @@ func TestUnmarshal(t *testing.T) {
 			if err != nil {
 				return
 			}
-			sort.Sort(Selectors(result.sel))
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roundTrip := &Selector{}
+			if err := roundTrip.UnmarshalJSON(data); err != nil {
+				t.Fatalf("Failed to unmarshal %s: %s", data, err)
+			}
+			if d := testy.DiffInterface(result, roundTrip); d != nil {
+				t.Errorf("Round trip of %s changed the selector:\n%s", data, d)
+			}
 			if d := testy.DiffInterface(test.expected, *result); d != nil {
 				t.Error(d)
 			}
@@ -132,6 +556,82 @@ func TestUnmarshal(t *testing.T) {
 	}
 }
 
+func TestMarshalJSON(t *testing.T) {
+	type mTest struct {
+		name     string
+		input    string
+		expected string
+	}
+	tests := []mTest{
+		{
+			name:     "empty",
+			input:    `{}`,
+			expected: `{}`,
+		},
+		{
+			name:     "implicit $eq",
+			input:    `{"name":"Paul"}`,
+			expected: `{"name":{"$eq":"Paul"}}`,
+		},
+		{
+			name:     "implicit $and",
+			input:    `{"name":"Paul","location":"Boston"}`,
+			expected: `{"$and":[{"name":{"$eq":"Paul"}},{"location":{"$eq":"Boston"}}]}`,
+		},
+		{
+			name:     "$and",
+			input:    `{"$and":[{"name":"Paul"},{"location":"Boston"}]}`,
+			expected: `{"$and":[{"name":{"$eq":"Paul"}},{"location":{"$eq":"Boston"}}]}`,
+		},
+		{
+			name:     "nested object",
+			input:    `{"imdb":{"rating":{"$gt":8}}}`,
+			expected: `{"imdb.rating":{"$gt":8}}`,
+		},
+		{
+			name:     "escaped field",
+			input:    `{"sites":{"example.com":1}}`,
+			expected: `{"sites.example\\.com":{"$eq":1}}`,
+		},
+		{
+			name:     "empty conditions",
+			input:    `{"a":{}}`,
+			expected: `{"a":{"$exists":true}}`,
+		},
+		{
+			name:     "field $not",
+			input:    `{"a":{"$not":{"$in":[1,2]}}}`,
+			expected: `{"$not":{"a":{"$in":[1,2]}}}`,
+		},
+		{
+			name:     "empty $or",
+			input:    `{"$or":[]}`,
+			expected: `{"$or":[]}`,
+		},
+		{
+			name:     "$elemMatch",
+			input:    `{"genre":{"$elemMatch":{"$eq":"Horror"}}}`,
+			expected: `{"genre":{"$elemMatch":{"$eq":"Horror"}}}`,
+		},
+		{
+			name:     "$regex",
+			input:    `{"title":{"$regex":"^A"}}`,
+			expected: `{"title":{"$regex":"^A"}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := json.Marshal(mustNew(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := testy.DiffText(test.expected, string(result)); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
 func mustNew(data string) *Selector {
 	s, e := New(data)
 	if e != nil {
@@ -140,6 +640,14 @@ func mustNew(data string) *Selector {
 	return s
 }
 
+func mustCompileRegex(pattern string) *regexp.Regexp {
+	re, err := compileRegex(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
 func TestMatches(t *testing.T) {
 	type mTest struct {
 		name     string
@@ -232,6 +740,495 @@ func TestMatches(t *testing.T) {
 			doc:      couchDoc{"foo": "aaa"},
 			expected: true,
 		},
+		{
+			name:     "$or hit",
+			sel:      mustNew(`{"$or":[{"foo":"bar"},{"foo":"baz"}]}`),
+			doc:      couchDoc{"foo": "baz"},
+			expected: true,
+		},
+		{
+			name:     "$or miss",
+			sel:      mustNew(`{"$or":[{"foo":"bar"},{"foo":"baz"}]}`),
+			doc:      couchDoc{"foo": "qux"},
+			expected: false,
+		},
+		{
+			name:     "empty $or",
+			sel:      mustNew(`{"$or":[]}`),
+			doc:      couchDoc{"foo": "qux"},
+			expected: true,
+		},
+		{
+			name:     "$nor hit",
+			sel:      mustNew(`{"$nor":[{"foo":"bar"},{"foo":"baz"}]}`),
+			doc:      couchDoc{"foo": "qux"},
+			expected: true,
+		},
+		{
+			name:     "$nor miss",
+			sel:      mustNew(`{"$nor":[{"foo":"bar"},{"foo":"baz"}]}`),
+			doc:      couchDoc{"foo": "bar"},
+			expected: false,
+		},
+		{
+			name:     "$and with nested $or",
+			sel:      mustNew(`{"$and":[{"$or":[{"a":1},{"b":2}]},{"c":3}]}`),
+			doc:      couchDoc{"b": float64(2), "c": float64(3)},
+			expected: true,
+		},
+		{
+			name:     "$or with nested $and",
+			sel:      mustNew(`{"$or":[{"$and":[{"a":1},{"b":2}]},{"c":3}]}`),
+			doc:      couchDoc{"a": float64(1), "b": float64(3)},
+			expected: false,
+		},
+		{
+			name: "error in $or",
+			sel:  &Selector{op: opOr, sel: []Selector{{op: "$invalid"}}},
+			doc:  couchDoc{},
+			err:  "unknown mango operator '$invalid'",
+		},
+		{
+			name:     "$not hit",
+			sel:      mustNew(`{"$not":{"foo":"bar"}}`),
+			doc:      couchDoc{"foo": "baz"},
+			expected: true,
+		},
+		{
+			name:     "$not miss",
+			sel:      mustNew(`{"$not":{"foo":"bar"}}`),
+			doc:      couchDoc{"foo": "bar"},
+			expected: false,
+		},
+		{
+			name:     "$not missing field",
+			sel:      mustNew(`{"$not":{"foo":"bar"}}`),
+			doc:      couchDoc{"baz": "bar"},
+			expected: true,
+		},
+		{
+			name:     "field $not missing field",
+			sel:      mustNew(`{"foo":{"$not":{"$gt":"bar"}}}`),
+			doc:      couchDoc{},
+			expected: true,
+		},
+		{
+			name:     "field $not hit",
+			sel:      mustNew(`{"foo":{"$not":{"$gt":"bar"}}}`),
+			doc:      couchDoc{"foo": "aaa"},
+			expected: true,
+		},
+		{
+			name:     "$ne hit",
+			sel:      mustNew(`{"foo":{"$ne":"bar"}}`),
+			doc:      couchDoc{"foo": "baz"},
+			expected: true,
+		},
+		{
+			name:     "$ne missing field",
+			sel:      mustNew(`{"foo":{"$ne":"bar"}}`),
+			doc:      couchDoc{},
+			expected: false,
+		},
+		{
+			name: "error in $not",
+			sel:  &Selector{op: opNot, sel: []Selector{{op: "$invalid"}}},
+			doc:  couchDoc{},
+			err:  "unknown mango operator '$invalid'",
+		},
+		{
+			name:     "$elemMatch hit",
+			sel:      mustNew(`{"genre":{"$elemMatch":{"$eq":"Horror"}}}`),
+			doc:      couchDoc{"genre": []interface{}{"Comedy", "Horror"}},
+			expected: true,
+		},
+		{
+			name:     "$elemMatch miss",
+			sel:      mustNew(`{"genre":{"$elemMatch":{"$eq":"Horror"}}}`),
+			doc:      couchDoc{"genre": []interface{}{"Comedy", "Drama"}},
+			expected: false,
+		},
+		{
+			name:     "$elemMatch empty array",
+			sel:      mustNew(`{"genre":{"$elemMatch":{"$eq":"Horror"}}}`),
+			doc:      couchDoc{"genre": []interface{}{}},
+			expected: false,
+		},
+		{
+			name:     "$elemMatch non-array",
+			sel:      mustNew(`{"genre":{"$elemMatch":{"$eq":"Horror"}}}`),
+			doc:      couchDoc{"genre": "Horror"},
+			expected: false,
+		},
+		{
+			name:     "$elemMatch missing field",
+			sel:      mustNew(`{"genre":{"$elemMatch":{"$eq":"Horror"}}}`),
+			doc:      couchDoc{},
+			expected: false,
+		},
+		{
+			name: "$elemMatch sub-objects",
+			sel:  mustNew(`{"items":{"$elemMatch":{"sku":"a","qty":{"$gte":2}}}}`),
+			doc: couchDoc{"items": []interface{}{
+				map[string]interface{}{"sku": "a", "qty": float64(1)},
+				map[string]interface{}{"sku": "b", "qty": float64(2)},
+				map[string]interface{}{"sku": "a", "qty": float64(2)},
+			}},
+			expected: true,
+		},
+		{
+			name:     "$elemMatch Go slice",
+			sel:      mustNew(`{"genre":{"$elemMatch":{"$gt":"C"}}}`),
+			doc:      couchDoc{"genre": []string{"A", "B", "Drama"}},
+			expected: true,
+		},
+		{
+			name: "$allMatch hit",
+			sel:  mustNew(`{"items":{"$allMatch":{"qty":{"$gt":0}}}}`),
+			doc: couchDoc{"items": []interface{}{
+				map[string]interface{}{"qty": float64(1)},
+				map[string]interface{}{"qty": float64(2)},
+			}},
+			expected: true,
+		},
+		{
+			name: "$allMatch miss",
+			sel:  mustNew(`{"items":{"$allMatch":{"qty":{"$gt":0}}}}`),
+			doc: couchDoc{"items": []interface{}{
+				map[string]interface{}{"qty": float64(1)},
+				map[string]interface{}{"sku": "a"},
+			}},
+			expected: false,
+		},
+		{
+			name:     "$allMatch empty array",
+			sel:      mustNew(`{"items":{"$allMatch":{"qty":{"$gt":0}}}}`),
+			doc:      couchDoc{"items": []interface{}{}},
+			expected: false,
+		},
+		{
+			name: "error in $elemMatch",
+			sel: &Selector{op: opElemMatch, field: "foo", sel: []Selector{
+				{op: "$invalid"},
+			}},
+			doc: couchDoc{"foo": []interface{}{1}},
+			err: "unknown mango operator '$invalid'",
+		},
+		{
+			name:     "$in hit",
+			sel:      mustNew(`{"status":{"$in":["a","b"]}}`),
+			doc:      couchDoc{"status": "b"},
+			expected: true,
+		},
+		{
+			name:     "$in miss",
+			sel:      mustNew(`{"status":{"$in":["a","b"]}}`),
+			doc:      couchDoc{"status": "c"},
+			expected: false,
+		},
+		{
+			name:     "$in array field",
+			sel:      mustNew(`{"status":{"$in":["a","b"]}}`),
+			doc:      couchDoc{"status": []interface{}{"c", "a"}},
+			expected: true,
+		},
+		{
+			name:     "$in numbers",
+			sel:      mustNew(`{"year":{"$in":[1990,2000]}}`),
+			doc:      couchDoc{"year": 2000},
+			expected: true,
+		},
+		{
+			name:     "$in missing field",
+			sel:      mustNew(`{"status":{"$in":["a","b"]}}`),
+			doc:      couchDoc{},
+			expected: false,
+		},
+		{
+			name:     "$nin hit",
+			sel:      mustNew(`{"status":{"$nin":["a","b"]}}`),
+			doc:      couchDoc{"status": "c"},
+			expected: true,
+		},
+		{
+			name:     "$nin miss",
+			sel:      mustNew(`{"status":{"$nin":["a","b"]}}`),
+			doc:      couchDoc{"status": "a"},
+			expected: false,
+		},
+		{
+			name:     "$nin array field",
+			sel:      mustNew(`{"status":{"$nin":["a","b"]}}`),
+			doc:      couchDoc{"status": []interface{}{"c", "b"}},
+			expected: false,
+		},
+		{
+			name:     "$nin missing field",
+			sel:      mustNew(`{"status":{"$nin":["a","b"]}}`),
+			doc:      couchDoc{},
+			expected: false,
+		},
+		{
+			name:     "$all hit",
+			sel:      mustNew(`{"tags":{"$all":["x","y"]}}`),
+			doc:      couchDoc{"tags": []interface{}{"y", "z", "x"}},
+			expected: true,
+		},
+		{
+			name:     "$all empty",
+			sel:      mustNew(`{"tags":{"$all":[]}}`),
+			doc:      couchDoc{"tags": []interface{}{"x"}},
+			expected: false,
+		},
+		{
+			name:     "$all miss",
+			sel:      mustNew(`{"tags":{"$all":["x","y"]}}`),
+			doc:      couchDoc{"tags": []interface{}{"y", "z"}},
+			expected: false,
+		},
+		{
+			name:     "$all non-array field",
+			sel:      mustNew(`{"tags":{"$all":["x"]}}`),
+			doc:      couchDoc{"tags": "x"},
+			expected: false,
+		},
+		{
+			name:     "$all single array argument",
+			sel:      mustNew(`{"tags":{"$all":[["x","y"]]}}`),
+			doc:      couchDoc{"tags": []interface{}{"x", "y"}},
+			expected: true,
+		},
+		{
+			name:     "$all nested array element",
+			sel:      mustNew(`{"tags":{"$all":[["x","y"]]}}`),
+			doc:      couchDoc{"tags": []interface{}{"z", []interface{}{"x", "y"}}},
+			expected: true,
+		},
+		{
+			name:     "$exists true hit",
+			sel:      mustNew(`{"foo":{"$exists":true}}`),
+			doc:      couchDoc{"foo": nil},
+			expected: true,
+		},
+		{
+			name:     "$exists true miss",
+			sel:      mustNew(`{"foo":{"$exists":true}}`),
+			doc:      couchDoc{"bar": "baz"},
+			expected: false,
+		},
+		{
+			name:     "$exists false hit",
+			sel:      mustNew(`{"foo":{"$exists":false}}`),
+			doc:      couchDoc{"bar": "baz"},
+			expected: true,
+		},
+		{
+			name:     "$exists false miss",
+			sel:      mustNew(`{"foo":{"$exists":false}}`),
+			doc:      couchDoc{"foo": "baz"},
+			expected: false,
+		},
+		{
+			name:     "$type hit",
+			sel:      mustNew(`{"foo":{"$type":"array"}}`),
+			doc:      couchDoc{"foo": []interface{}{}},
+			expected: true,
+		},
+		{
+			name:     "$type null",
+			sel:      mustNew(`{"foo":{"$type":"null"}}`),
+			doc:      couchDoc{"foo": nil},
+			expected: true,
+		},
+		{
+			name:     "$type miss",
+			sel:      mustNew(`{"foo":{"$type":"string"}}`),
+			doc:      couchDoc{"foo": float64(1)},
+			expected: false,
+		},
+		{
+			name:     "$type missing field",
+			sel:      mustNew(`{"foo":{"$type":"null"}}`),
+			doc:      couchDoc{},
+			expected: false,
+		},
+		{
+			name:     "$type unknown type",
+			sel:      mustNew(`{"foo":{"$type":"integer"}}`),
+			doc:      couchDoc{"foo": float64(1)},
+			expected: false,
+		},
+		{
+			name:     "$size hit",
+			sel:      mustNew(`{"tags":{"$size":2}}`),
+			doc:      couchDoc{"tags": []interface{}{"a", "b"}},
+			expected: true,
+		},
+		{
+			name:     "$size miss",
+			sel:      mustNew(`{"tags":{"$size":2}}`),
+			doc:      couchDoc{"tags": []interface{}{"a"}},
+			expected: false,
+		},
+		{
+			name:     "$size zero",
+			sel:      mustNew(`{"tags":{"$size":0}}`),
+			doc:      couchDoc{"tags": []interface{}{}},
+			expected: true,
+		},
+		{
+			name:     "$size non-array",
+			sel:      mustNew(`{"tags":{"$size":2}}`),
+			doc:      couchDoc{"tags": "ab"},
+			expected: false,
+		},
+		{
+			name:     "$mod hit",
+			sel:      mustNew(`{"year":{"$mod":[4,0]}}`),
+			doc:      couchDoc{"year": float64(2000)},
+			expected: true,
+		},
+		{
+			name:     "$mod miss",
+			sel:      mustNew(`{"year":{"$mod":[4,0]}}`),
+			doc:      couchDoc{"year": float64(2001)},
+			expected: false,
+		},
+		{
+			name:     "$mod negative dividend",
+			sel:      mustNew(`{"year":{"$mod":[4,-1]}}`),
+			doc:      couchDoc{"year": float64(-5)},
+			expected: true,
+		},
+		{
+			name:     "$mod Go int",
+			sel:      mustNew(`{"year":{"$mod":[4,1]}}`),
+			doc:      couchDoc{"year": 2001},
+			expected: true,
+		},
+		{
+			name:     "$mod fractional value",
+			sel:      mustNew(`{"year":{"$mod":[4,0]}}`),
+			doc:      couchDoc{"year": float64(2000.5)},
+			expected: false,
+		},
+		{
+			name:     "$mod non-number",
+			sel:      mustNew(`{"year":{"$mod":[4,0]}}`),
+			doc:      couchDoc{"year": "2000"},
+			expected: false,
+		},
+		{
+			name:     "$regex hit",
+			sel:      mustNew(`{"name":{"$regex":"^A"}}`),
+			doc:      couchDoc{"name": "Alice"},
+			expected: true,
+		},
+		{
+			name:     "$regex miss",
+			sel:      mustNew(`{"name":{"$regex":"^A"}}`),
+			doc:      couchDoc{"name": "Bob"},
+			expected: false,
+		},
+		{
+			name:     "$regex non-string",
+			sel:      mustNew(`{"name":{"$regex":"1"}}`),
+			doc:      couchDoc{"name": float64(1)},
+			expected: false,
+		},
+		{
+			name:     "$regex missing field",
+			sel:      mustNew(`{"name":{"$regex":".*"}}`),
+			doc:      couchDoc{},
+			expected: false,
+		},
+		{
+			name:     "nested field",
+			sel:      mustNew(`{"address.city":"Boston"}`),
+			doc:      couchDoc{"address": map[string]interface{}{"city": "Boston"}},
+			expected: true,
+		},
+		{
+			name:     "nested field miss",
+			sel:      mustNew(`{"address.city":"Boston"}`),
+			doc:      couchDoc{"address": "Boston"},
+			expected: false,
+		},
+		{
+			name:     "escaped period",
+			sel:      mustNew(`{"example\\.com":true}`),
+			doc:      couchDoc{"example.com": true},
+			expected: true,
+		},
+		{
+			name: "array index",
+			sel:  mustNew(`{"items.1.sku":{"$regex":"^b"}}`),
+			doc: couchDoc{"items": []interface{}{
+				map[string]interface{}{"sku": "a"},
+				map[string]interface{}{"sku": "b"},
+			}},
+			expected: true,
+		},
+		{
+			name:     "nested $elemMatch",
+			sel:      mustNew(`{"order.items":{"$elemMatch":{"product.sku":"a"}}}`),
+			doc:      couchDoc{"order": map[string]interface{}{"items": []interface{}{map[string]interface{}{"product": map[string]interface{}{"sku": "a"}}}}},
+			expected: true,
+		},
+		{
+			name:     "nested $exists false",
+			sel:      mustNew(`{"address.zip":{"$exists":false}}`),
+			doc:      couchDoc{"address": map[string]interface{}{"city": "Boston"}},
+			expected: true,
+		},
+		{
+			name:     "$exists false bad path",
+			sel:      mustNew(`{"address.zip":{"$exists":false}}`),
+			doc:      couchDoc{"address": "Boston"},
+			expected: false,
+		},
+		{
+			name:     "subfield hit",
+			sel:      mustNew(`{"imdb":{"rating":{"$gt":7}}}`),
+			doc:      couchDoc{"imdb": map[string]interface{}{"rating": float64(8)}},
+			expected: true,
+		},
+		{
+			name:     "subfield containing a period",
+			sel:      mustNew(`{"sites":{"example.com":1}}`),
+			doc:      couchDoc{"sites": map[string]interface{}{"example.com": float64(1)}},
+			expected: true,
+		},
+		{
+			name:     "range hit",
+			sel:      mustNew(`{"year":{"$gte":1990,"$lt":2000}}`),
+			doc:      couchDoc{"year": float64(1995)},
+			expected: true,
+		},
+		{
+			name:     "range miss",
+			sel:      mustNew(`{"year":{"$gte":1990,"$lt":2000}}`),
+			doc:      couchDoc{"year": float64(2000)},
+			expected: false,
+		},
+		{
+			name:     "field $or",
+			sel:      mustNew(`{"year":{"$or":[{"$lt":1990},{"$gt":2000}]}}`),
+			doc:      couchDoc{"year": float64(2001)},
+			expected: true,
+		},
+		{
+			name:     "empty condition",
+			sel:      mustNew(`{"imdb":{}}`),
+			doc:      couchDoc{"imdb": "x"},
+			expected: true,
+		},
+		{
+			name:     "empty condition missing field",
+			sel:      mustNew(`{"imdb":{}}`),
+			doc:      couchDoc{},
+			expected: false,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -0,0 +1,41 @@
+package mango
+
+import (
+	"github.com/go-kivik/mango/collate"
+)
+
+// Matcher evaluates selectors against documents, comparing values with a
+// collation.
+type Matcher struct {
+	collation collate.Collation
+}
+
+// NewMatcher returns a Matcher which compares values with c, as for $eq,
+// $ne, $lt, $lte, $gt, $gte, $in, $nin and $all.
+func NewMatcher(c collate.Collation) *Matcher {
+	return &Matcher{collation: c}
+}
+
+// Matches returns true if doc matches s.
+func (m *Matcher) Matches(s *Selector, doc map[string]interface{}) (bool, error) {
+	return s.match(m.collation, doc)
+}
+
+// Normalize is like Selector.Normalize, but compares values with the
+// Matcher's collation.
+func (m *Matcher) Normalize(s *Selector) *Selector {
+	n := normalize(m.collation, *s)
+	return &n
+}
+
+// Implies is like the Implies function, but compares values with the
+// Matcher's collation.
+func (m *Matcher) Implies(a, b *Selector) bool {
+	return impliesWith(m.collation, a, b)
+}
+
+// Satisfy is like Selector.Satisfy, but compares values with the Matcher's
+// collation.
+func (m *Matcher) Satisfy(s *Selector) (Satisfiability, map[string]interface{}) {
+	return satisfyDoc(m.collation, s)
+}
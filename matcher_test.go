@@ -0,0 +1,144 @@
+package mango
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-kivik/mango/collate"
+)
+
+// foldCase is a case-insensitive collation, for testing.
+type foldCase struct {
+	collate.Raw
+}
+
+var _ collate.Collation = &foldCase{}
+
+func lower(i interface{}) interface{} {
+	if s, ok := i.(string); ok {
+		return strings.ToLower(s)
+	}
+	return i
+}
+
+func (c *foldCase) Compare(i, j interface{}) int {
+	return c.Raw.Compare(lower(i), lower(j))
+}
+
+func (c *foldCase) Eq(i, j interface{}) bool  { return c.Raw.Eq(lower(i), lower(j)) }
+func (c *foldCase) LT(i, j interface{}) bool  { return c.Raw.LT(lower(i), lower(j)) }
+func (c *foldCase) LTE(i, j interface{}) bool { return c.Raw.LTE(lower(i), lower(j)) }
+func (c *foldCase) GT(i, j interface{}) bool  { return c.Raw.GT(lower(i), lower(j)) }
+func (c *foldCase) GTE(i, j interface{}) bool { return c.Raw.GTE(lower(i), lower(j)) }
+
+func TestMatcher(t *testing.T) {
+	type mTest struct {
+		name       string
+		sel        string
+		doc        map[string]interface{}
+		raw, folds bool
+	}
+	tests := []mTest{
+		{
+			name:  "$eq",
+			sel:   `{"name":"paul"}`,
+			doc:   map[string]interface{}{"name": "Paul"},
+			folds: true,
+		},
+		{
+			name: "$ne",
+			sel:  `{"name":{"$ne":"paul"}}`,
+			doc:  map[string]interface{}{"name": "Paul"},
+			raw:  true,
+		},
+		{
+			name: "$gt",
+			sel:  `{"name":{"$gt":"b"}}`,
+			doc:  map[string]interface{}{"name": "Alice"},
+		},
+		{
+			name: "$lt",
+			sel:  `{"name":{"$lt":"b"}}`,
+			doc:  map[string]interface{}{"name": "Bob"},
+			raw:  true,
+		},
+		{
+			name:  "$in",
+			sel:   `{"tags":{"$in":["go"]}}`,
+			doc:   map[string]interface{}{"tags": []interface{}{"Go", "CouchDB"}},
+			folds: true,
+		},
+		{
+			name:  "$all within $elemMatch",
+			sel:   `{"a":{"$elemMatch":{"b":{"$all":["x","y"]}}}}`,
+			doc:   map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": []interface{}{"X", "Y"}}}},
+			folds: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sel := mustNew(test.sel)
+			raw, err := NewMatcher(&collate.Raw{}).Matches(sel, test.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if raw != test.raw {
+				t.Errorf("Expected raw collation to give %t, got %t", test.raw, raw)
+			}
+			if m, _ := sel.Matches(test.doc); m != raw {
+				t.Errorf("Expected Matches to use raw collation")
+			}
+			folds, err := NewMatcher(&foldCase{}).Matches(sel, test.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if folds != test.folds {
+				t.Errorf("Expected case-insensitive collation to give %t, got %t", test.folds, folds)
+			}
+		})
+	}
+}
+
+func TestMatcherNormalize(t *testing.T) {
+	sel := mustNew(`{"a":{"$gt":"a","$lt":"B"}}`)
+	if n := sel.Normalize(); !n.isNever() {
+		t.Errorf("Expected raw collation to find no match, got %v", n)
+	}
+	m := NewMatcher(&collate.Unicode{})
+	if n := m.Normalize(sel); !n.Equal(sel) {
+		t.Errorf("Expected Unicode collation to keep the range, got %v", n)
+	}
+	doc := map[string]interface{}{"a": "aa"}
+	if ok, _ := m.Matches(sel, doc); !ok {
+		t.Errorf("Expected %v to match", doc)
+	}
+}
+
+func TestMatcherImplies(t *testing.T) {
+	a, b := mustNew(`{"a":{"$gt":"a"}}`), mustNew(`{"a":{"$gt":"B"}}`)
+	if !Implies(a, b) {
+		t.Errorf("Expected raw collation to find that a implies b")
+	}
+	m := NewMatcher(&collate.Unicode{})
+	if m.Implies(a, b) {
+		t.Errorf("Expected Unicode collation to find that a does not imply b")
+	}
+	if !m.Implies(b, a) {
+		t.Errorf("Expected Unicode collation to find that b implies a")
+	}
+}
+
+func TestMatcherSatisfy(t *testing.T) {
+	sel := mustNew(`{"a":{"$gt":"a","$lt":"B"}}`)
+	if result, _ := sel.Satisfy(); result != Unsatisfiable {
+		t.Errorf("Expected raw collation to give unsatisfiable, got %s", result)
+	}
+	m := NewMatcher(&collate.Unicode{})
+	result, doc := m.Satisfy(sel)
+	if result != Satisfiable {
+		t.Fatalf("Expected Unicode collation to give satisfiable, got %s", result)
+	}
+	if ok, _ := m.Matches(sel, doc); !ok {
+		t.Errorf("Expected %v to match", doc)
+	}
+}
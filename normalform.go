@@ -0,0 +1,254 @@
+package mango
+
+import (
+	"errors"
+)
+
+// ErrTooManyClauses is returned by DNF and CNF when the normal form would
+// have more clauses than the given limit.
+var ErrTooManyClauses = errors.New("normal form exceeds the clause limit")
+
+// NNF returns s in negation normal form, which matches the same documents,
+// but in which $not is only applied directly to conditions, and $nor is not
+// used.
+//
+// Negated conditions are inverted where possible. A negated condition also
+// matches documents in which the field is missing, so for example
+// {"$not":{"a":{"$lt":5}}} becomes
+// {"$or":[{"a":{"$gte":5}},{"a":{"$exists":false}}]}. $exists:false does
+// not match a path which cannot be followed, such as a.b where a is a
+// string, so where such a path is possible, {"$not":{"a.b":{"$exists":true}}}
+// is used instead. Conditions with no inverse, such as $regex, remain
+// negated.
+func (s *Selector) NNF() *Selector {
+	n := nnf(*s, false, false)
+	return &n
+}
+
+// DNF returns s in disjunctive normal form: an $or of $and of the
+// conditions of s, in negation normal form. An $or or $and of a single
+// clause is not wrapped. Selectors within $elemMatch and $allMatch are in
+// negation normal form only.
+//
+// Conversion may multiply the number of clauses. If the $or would have more
+// than limit clauses, ErrTooManyClauses is returned. A limit of 0 means no
+// limit.
+func (s *Selector) DNF(limit int) (*Selector, error) {
+	return normalForm(*s, opOr, limit)
+}
+
+// CNF returns s in conjunctive normal form: an $and of $or of the
+// conditions of s, in negation normal form. An $and or $or of a single
+// clause is not wrapped. Selectors within $elemMatch and $allMatch are in
+// negation normal form only.
+//
+// Conversion may multiply the number of clauses. If the $and would have more
+// than limit clauses, ErrTooManyClauses is returned. A limit of 0 means no
+// limit.
+func (s *Selector) CNF(limit int) (*Selector, error) {
+	return normalForm(*s, opAnd, limit)
+}
+
+// nnf returns s in negation normal form, negated if neg is true. elem is
+// true within $elemMatch and $allMatch, where the value being matched may
+// not be an object.
+func nnf(s Selector, neg, elem bool) Selector {
+	switch s.op {
+	case opNone:
+		if neg {
+			return never()
+		}
+		return s
+	case opAnd:
+		if neg {
+			return orOf(nnfAll(s.sel, true, elem))
+		}
+		return andOf(nnfAll(s.sel, false, elem))
+	case opOr:
+		if len(s.sel) == 0 {
+			// An empty $or matches everything.
+			return nnf(Selector{}, neg, elem)
+		}
+		if neg {
+			return andOf(nnfAll(s.sel, true, elem))
+		}
+		return orOf(nnfAll(s.sel, false, elem))
+	case opNor:
+		if neg {
+			return orOf(nnfAll(s.sel, false, elem))
+		}
+		return andOf(nnfAll(s.sel, true, elem))
+	case opNot:
+		return nnf(s.sel[0], !neg, elem)
+	case opElemMatch, opAllMatch:
+		s.sel = []Selector{nnf(s.sel[0], false, true)}
+	}
+	if neg {
+		return negate(s, elem)
+	}
+	return s
+}
+
+func nnfAll(sels []Selector, neg, elem bool) []Selector {
+	result := make([]Selector, len(sels))
+	for i, sel := range sels {
+		result[i] = nnf(sel, neg, elem)
+	}
+	return result
+}
+
+// inverses maps condition operators to the operator matching every present
+// value which the original does not.
+var inverses = map[operator]operator{
+	opEq:  opNE,
+	opNE:  opEq,
+	opLT:  opGTE,
+	opLTE: opGT,
+	opGT:  opLTE,
+	opGTE: opLT,
+	opIn:  opNIn,
+	opNIn: opIn,
+}
+
+// negate returns the negation of the condition s.
+func negate(s Selector, elem bool) Selector {
+	if s.op == opExists {
+		if s.value.(bool) {
+			return missing(s.field, elem)
+		}
+		if !badPathPossible(s.field, elem) {
+			return Selector{op: opExists, field: s.field, value: true}
+		}
+	}
+	inverse, ok := inverses[s.op]
+	if !ok {
+		return Selector{op: opNot, sel: []Selector{s}}
+	}
+	inv := Selector{op: inverse, field: s.field, value: s.value}
+	if s.field == "" {
+		// The array element itself is always present.
+		return inv
+	}
+	return orOf([]Selector{inv, missing(s.field, elem)})
+}
+
+// missing returns a condition matching when field is not present.
+func missing(field string, elem bool) Selector {
+	if badPathPossible(field, elem) {
+		return Selector{
+			op:  opNot,
+			sel: []Selector{{op: opExists, field: field, value: true}},
+		}
+	}
+	return Selector{op: opExists, field: field, value: false}
+}
+
+// badPathPossible returns true if field may refer to a path which cannot be
+// followed, because it traverses a value which may not be an object.
+func badPathPossible(field string, elem bool) bool {
+	if elem {
+		return true
+	}
+	path, _ := splitField(field)
+	return len(path) > 1
+}
+
+// andOf combines sels with $and, flattening any nested $and.
+func andOf(sels []Selector) Selector {
+	return combine(opAnd, flatten(opAnd, sels))
+}
+
+// orOf combines sels with $or, flattening any nested $or. Unlike an empty
+// $or, the result matches nothing if sels is empty.
+func orOf(sels []Selector) Selector {
+	flat := flatten(opOr, sels)
+	if len(flat) == 0 {
+		return never()
+	}
+	return combine(opOr, flat)
+}
+
+func flatten(op operator, sels []Selector) []Selector {
+	var flat []Selector
+	for _, sel := range sels {
+		if sel.op == op {
+			flat = append(flat, sel.sel...)
+			continue
+		}
+		flat = append(flat, sel)
+	}
+	return flat
+}
+
+// normalForm converts s to disjunctive normal form, if outer is $or, or to
+// conjunctive normal form, if outer is $and.
+func normalForm(s Selector, outer operator, limit int) (*Selector, error) {
+	clauses, err := normalClauses(nnf(s, false, false), outer, limit)
+	if err != nil {
+		return nil, err
+	}
+	combined := make([]Selector, len(clauses))
+	for i, clause := range clauses {
+		if outer == opOr {
+			combined[i] = andOf(clause)
+		} else {
+			combined[i] = orOf(clause)
+		}
+	}
+	var result Selector
+	if outer == opOr {
+		result = orOf(combined)
+	} else {
+		result = andOf(combined)
+	}
+	return &result, nil
+}
+
+// normalClauses returns the clauses of s, in negation normal form, which are
+// combined by outer, each of which is a list of conditions combined by the
+// other of $and and $or.
+func normalClauses(s Selector, outer operator, limit int) ([][]Selector, error) {
+	inner := opAnd
+	if outer == opAnd {
+		inner = opOr
+	}
+	switch s.op {
+	case outer:
+		var result [][]Selector
+		for _, sel := range s.sel {
+			clauses, err := normalClauses(sel, outer, limit)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, clauses...)
+			if limit > 0 && len(result) > limit {
+				return nil, ErrTooManyClauses
+			}
+		}
+		return result, nil
+	case inner:
+		// Distribute inner over outer, so that (a OR b) AND (c OR d)
+		// becomes (a AND c) OR (a AND d) OR (b AND c) OR (b AND d).
+		result := [][]Selector{{}}
+		for _, sel := range s.sel {
+			clauses, err := normalClauses(sel, outer, limit)
+			if err != nil {
+				return nil, err
+			}
+			if limit > 0 && len(result)*len(clauses) > limit {
+				return nil, ErrTooManyClauses
+			}
+			product := make([][]Selector, 0, len(result)*len(clauses))
+			for _, r := range result {
+				for _, c := range clauses {
+					clause := make([]Selector, 0, len(r)+len(c))
+					clause = append(append(clause, r...), c...)
+					product = append(product, clause)
+				}
+			}
+			result = product
+		}
+		return result, nil
+	}
+	return [][]Selector{{s}}, nil
+}
@@ -0,0 +1,217 @@
+package mango
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+// normalFormDocs are used to check that normal forms match the same
+// documents as the original selector.
+var normalFormDocs = []couchDoc{
+	{},
+	{"a": float64(1)},
+	{"a": float64(5), "b": float64(2)},
+	{"a": "x", "b": float64(3), "c": float64(1)},
+	{"a": nil, "c": float64(2)},
+	{"a": map[string]interface{}{"b": float64(1)}},
+	{"a": []interface{}{float64(1), "x", map[string]interface{}{"b": float64(2)}}},
+}
+
+func testSameMatches(t *testing.T, sel, result *Selector) {
+	t.Helper()
+	for _, doc := range normalFormDocs {
+		want, _ := sel.Matches(doc)
+		got, _ := result.Matches(doc)
+		if got != want {
+			t.Errorf("Result gives %t for %v, expected %t", got, doc, want)
+		}
+	}
+}
+
+func TestNNF(t *testing.T) {
+	type nnfTest struct {
+		name     string
+		input    string
+		expected string
+	}
+	tests := []nnfTest{
+		{
+			name:     "no negation",
+			input:    `{"a":1,"b":{"$gt":2}}`,
+			expected: `{"$and":[{"a":{"$eq":1}},{"b":{"$gt":2}}]}`,
+		},
+		{
+			name:     "$not $lt",
+			input:    `{"a":{"$not":{"$lt":5}}}`,
+			expected: `{"$or":[{"a":{"$gte":5}},{"a":{"$exists":false}}]}`,
+		},
+		{
+			name:     "$not $eq on nested field",
+			input:    `{"$not":{"a.b":1}}`,
+			expected: `{"$or":[{"a.b":{"$ne":1}},{"$not":{"a.b":{"$exists":true}}}]}`,
+		},
+		{
+			name:     "$not $in",
+			input:    `{"$not":{"a":{"$in":[1,2]}}}`,
+			expected: `{"$or":[{"a":{"$nin":[1,2]}},{"a":{"$exists":false}}]}`,
+		},
+		{
+			name:     "$not $exists",
+			input:    `{"$not":{"a":{"$exists":true},"b":{"$exists":false}}}`,
+			expected: `{"$or":[{"a":{"$exists":false}},{"b":{"$exists":true}}]}`,
+		},
+		{
+			name:     "$not $exists false on nested field",
+			input:    `{"$not":{"a.b":{"$exists":false}}}`,
+			expected: `{"$not":{"a.b":{"$exists":false}}}`,
+		},
+		{
+			name:     "no inverse",
+			input:    `{"$not":{"a":{"$regex":"x"}}}`,
+			expected: `{"$not":{"a":{"$regex":"x"}}}`,
+		},
+		{
+			name:     "De Morgan",
+			input:    `{"$not":{"$or":[{"a":1},{"$and":[{"b":{"$gt":1}},{"c":{"$type":"number"}}]}]}}`,
+			expected: `{"$and":[{"$or":[{"a":{"$ne":1}},{"a":{"$exists":false}}]},{"$or":[{"b":{"$lte":1}},{"b":{"$exists":false}},{"$not":{"c":{"$type":"number"}}}]}]}`,
+		},
+		{
+			name:     "double negation",
+			input:    `{"$not":{"$not":{"a":1}}}`,
+			expected: `{"a":{"$eq":1}}`,
+		},
+		{
+			name:     "$nor",
+			input:    `{"$nor":[{"a":1},{"b":2}]}`,
+			expected: `{"$and":[{"$or":[{"a":{"$ne":1}},{"a":{"$exists":false}}]},{"$or":[{"b":{"$ne":2}},{"b":{"$exists":false}}]}]}`,
+		},
+		{
+			name:     "negated $nor",
+			input:    `{"$not":{"$nor":[{"a":1},{"b":2}]}}`,
+			expected: `{"$or":[{"a":{"$eq":1}},{"b":{"$eq":2}}]}`,
+		},
+		{
+			name:     "negated empty $or",
+			input:    `{"$not":{"$or":[]}}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "negated empty $nor",
+			input:    `{"$not":{"$nor":[]}}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "within $elemMatch",
+			input:    `{"a":{"$elemMatch":{"$not":{"$gt":1,"b":1}}}}`,
+			expected: `{"a":{"$elemMatch":{"$or":[{"$lte":1},{"b":{"$ne":1}},{"$not":{"b":{"$exists":true}}}]}}}`,
+		},
+		{
+			name:     "negated $elemMatch",
+			input:    `{"$not":{"a":{"$elemMatch":{"$not":{"$eq":1}}}}}`,
+			expected: `{"$not":{"a":{"$elemMatch":{"$ne":1}}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sel := mustNew(test.input)
+			result := sel.NNF()
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := testy.DiffText(test.expected, string(data)); d != nil {
+				t.Error(d)
+			}
+			testSameMatches(t, sel, result)
+		})
+	}
+}
+
+func TestDNFAndCNF(t *testing.T) {
+	type nfTest struct {
+		name   string
+		input  string
+		limit  int
+		dnf    string
+		cnf    string
+		dnfErr string
+		cnfErr string
+	}
+	tests := []nfTest{
+		{
+			name:  "condition",
+			input: `{"a":1}`,
+			dnf:   `{"a":{"$eq":1}}`,
+			cnf:   `{"a":{"$eq":1}}`,
+		},
+		{
+			name:  "empty",
+			input: `{}`,
+			dnf:   `{}`,
+			cnf:   `{}`,
+		},
+		{
+			name:  "distribution",
+			input: `{"$or":[{"a":1},{"b":1}],"c":{"$or":[{"$lt":1},{"$gt":2}]}}`,
+			dnf:   `{"$or":[{"$and":[{"a":{"$eq":1}},{"c":{"$lt":1}}]},{"$and":[{"a":{"$eq":1}},{"c":{"$gt":2}}]},{"$and":[{"b":{"$eq":1}},{"c":{"$lt":1}}]},{"$and":[{"b":{"$eq":1}},{"c":{"$gt":2}}]}]}`,
+			cnf:   `{"$and":[{"$or":[{"a":{"$eq":1}},{"b":{"$eq":1}}]},{"$or":[{"c":{"$lt":1}},{"c":{"$gt":2}}]}]}`,
+		},
+		{
+			name:  "negation",
+			input: `{"$nor":[{"a":1,"b":1}]}`,
+			dnf:   `{"$or":[{"a":{"$ne":1}},{"a":{"$exists":false}},{"b":{"$ne":1}},{"b":{"$exists":false}}]}`,
+			cnf:   `{"$or":[{"a":{"$ne":1}},{"a":{"$exists":false}},{"b":{"$ne":1}},{"b":{"$exists":false}}]}`,
+		},
+		{
+			name:  "within limit",
+			input: `{"$or":[{"a":1},{"b":1}],"c":{"$or":[{"$lt":1},{"$gt":2}]}}`,
+			limit: 4,
+			dnf:   `{"$or":[{"$and":[{"a":{"$eq":1}},{"c":{"$lt":1}}]},{"$and":[{"a":{"$eq":1}},{"c":{"$gt":2}}]},{"$and":[{"b":{"$eq":1}},{"c":{"$lt":1}}]},{"$and":[{"b":{"$eq":1}},{"c":{"$gt":2}}]}]}`,
+			cnf:   `{"$and":[{"$or":[{"a":{"$eq":1}},{"b":{"$eq":1}}]},{"$or":[{"c":{"$lt":1}},{"c":{"$gt":2}}]}]}`,
+		},
+		{
+			name:   "exceeds limit",
+			input:  `{"$or":[{"a":1},{"b":1}],"c":{"$or":[{"$lt":1},{"$gt":2}]}}`,
+			limit:  3,
+			dnfErr: "normal form exceeds the clause limit",
+			cnf:    `{"$and":[{"$or":[{"a":{"$eq":1}},{"b":{"$eq":1}}]},{"$or":[{"c":{"$lt":1}},{"c":{"$gt":2}}]}]}`,
+		},
+		{
+			name:   "CNF exceeds limit",
+			input:  `{"$or":[{"a":1,"b":1},{"c":1,"d":1}]}`,
+			limit:  3,
+			dnf:    `{"$or":[{"$and":[{"a":{"$eq":1}},{"b":{"$eq":1}}]},{"$and":[{"c":{"$eq":1}},{"d":{"$eq":1}}]}]}`,
+			cnfErr: "normal form exceeds the clause limit",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sel := mustNew(test.input)
+			for _, form := range []struct {
+				name     string
+				convert  func(int) (*Selector, error)
+				expected string
+				err      string
+			}{
+				{"DNF", sel.DNF, test.dnf, test.dnfErr},
+				{"CNF", sel.CNF, test.cnf, test.cnfErr},
+			} {
+				result, err := form.convert(test.limit)
+				testy.Error(t, form.err, err)
+				if err != nil {
+					continue
+				}
+				data, err := json.Marshal(result)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if d := testy.DiffText(form.expected, string(data)); d != nil {
+					t.Errorf("%s: %s", form.name, d)
+				}
+				testSameMatches(t, sel, result)
+			}
+		})
+	}
+}
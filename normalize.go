@@ -0,0 +1,306 @@
+package mango
+
+import (
+	"encoding/json"
+
+	"github.com/go-kivik/mango/collate"
+)
+
+// never returns a selector which matches no documents, {"$not":{}}.
+func never() Selector {
+	return Selector{
+		op:  opNot,
+		sel: []Selector{{}},
+	}
+}
+
+// isNever returns true if s is the selector returned by never.
+func (s *Selector) isNever() bool {
+	return s.op == opNot && s.sel[0].op == opNone
+}
+
+// Normalize returns a simpler selector, which matches the same documents as
+// s. Nested combinations of the same kind are flattened, duplicate clauses
+// are removed, and range conditions on the same field are merged, so that
+// {"$and":[{"a":{"$gt":5}},{"$and":[{"a":{"$gt":3}}]}]} becomes
+// {"a":{"$gt":5}}. A selector found to be unsatisfiable, such as
+// {"a":{"$gt":5,"$lt":3}}, is normalized to {"$not":{}}, which matches no
+// documents. Values are compared with raw collation, as by Matches; use a
+// Matcher to compare them with another collation.
+func (s *Selector) Normalize() *Selector {
+	n := normalize(&collate.Raw{}, *s)
+	return &n
+}
+
+// normalize normalizes s, comparing values with c.
+func normalize(c collate.Collation, s Selector) Selector {
+	switch s.op {
+	case opAnd:
+		return normalizeAnd(c, normalizeAll(c, s.sel))
+	case opOr:
+		if len(s.sel) == 0 {
+			// An empty $or matches everything.
+			return Selector{}
+		}
+		return normalizeOr(normalizeAll(c, s.sel))
+	case opNor:
+		return normalizeNor(normalizeAll(c, s.sel))
+	case opNot:
+		sel := normalize(c, s.sel[0])
+		switch {
+		case sel.op == opNone:
+			return never()
+		case sel.isNever():
+			return Selector{}
+		case sel.op == opNot:
+			return sel.sel[0]
+		}
+		return Selector{op: opNot, sel: []Selector{sel}}
+	case opElemMatch, opAllMatch:
+		sel := normalize(c, s.sel[0])
+		if sel.isNever() {
+			// No array element can match, and an empty array never does.
+			return never()
+		}
+		return Selector{op: s.op, field: s.field, sel: []Selector{sel}}
+	case opIn, opAll:
+		if len(s.value.([]interface{})) == 0 {
+			return never()
+		}
+	}
+	return s
+}
+
+func normalizeAll(c collate.Collation, sels []Selector) []Selector {
+	result := make([]Selector, len(sels))
+	for i, sel := range sels {
+		result[i] = normalize(c, sel)
+	}
+	return result
+}
+
+// normalizeAnd combines sels, which have already been normalized, with $and.
+func normalizeAnd(c collate.Collation, sels []Selector) Selector {
+	var flat []Selector
+	for _, sel := range sels {
+		switch {
+		case sel.op == opNone:
+			continue
+		case sel.isNever():
+			return never()
+		case sel.op == opAnd:
+			flat = append(flat, sel.sel...)
+		default:
+			flat = append(flat, sel)
+		}
+	}
+	flat, ok := mergeConditions(c, dedupe(flat))
+	if !ok {
+		return never()
+	}
+	return combine(opAnd, flat)
+}
+
+// normalizeOr combines sels, which have already been normalized, with $or.
+func normalizeOr(sels []Selector) Selector {
+	flat, ok := flattenOr(sels)
+	if !ok {
+		return Selector{}
+	}
+	if len(flat) == 0 {
+		return never()
+	}
+	return combine(opOr, dedupe(flat))
+}
+
+// normalizeNor combines sels, which have already been normalized, with
+// $nor.
+func normalizeNor(sels []Selector) Selector {
+	flat, ok := flattenOr(sels)
+	if !ok {
+		return never()
+	}
+	flat = dedupe(flat)
+	if len(flat) == 0 {
+		return Selector{}
+	}
+	return Selector{op: opNor, sel: flat}
+}
+
+// flattenOr returns the alternatives in sels, flattening nested $or and
+// removing those which never match. It returns false if any alternative
+// matches everything.
+func flattenOr(sels []Selector) ([]Selector, bool) {
+	var flat []Selector
+	for _, sel := range sels {
+		switch {
+		case sel.op == opNone:
+			return nil, false
+		case sel.isNever():
+			continue
+		case sel.op == opOr:
+			flat = append(flat, sel.sel...)
+		default:
+			flat = append(flat, sel)
+		}
+	}
+	return flat, true
+}
+
+// combine combines sels with op, unless there are fewer than two.
+func combine(op operator, sels []Selector) Selector {
+	switch len(sels) {
+	case 0:
+		return Selector{}
+	case 1:
+		return sels[0]
+	}
+	return Selector{op: op, sel: sels}
+}
+
+// dedupe removes any selectors from sels which are identical to an earlier
+// one.
+func dedupe(sels []Selector) []Selector {
+	seen := make(map[string]bool, len(sels))
+	var result []Selector
+	for _, sel := range sels {
+		// sels may be within $elemMatch or $allMatch, so conditions on the
+		// array element itself are allowed.
+		v, _ := sel.jsonValue(true)
+		key, _ := json.Marshal(v)
+		if seen[string(key)] {
+			continue
+		}
+		seen[string(key)] = true
+		result = append(result, sel)
+	}
+	return result
+}
+
+// fieldBounds collects the conditions on a single field within an $and.
+type fieldBounds struct {
+	eq, lower, upper *Selector
+	ne               []*Selector
+	exists           *bool
+	// valued is true if any condition requires the field to exist.
+	valued bool
+}
+
+// mergeConditions merges the conditions on each field in sels, which are
+// combined with $and. Only the tightest lower and upper bounds on a field
+// are kept, and bounds and $ne conditions implied by an $eq condition are
+// removed, as is $exists:true when implied by another condition. It returns
+// false if the conditions on any field contradict each other. Values are
+// compared with c.
+func mergeConditions(c collate.Collation, sels []Selector) ([]Selector, bool) {
+	fields := make(map[string]*fieldBounds)
+	for i := range sels {
+		sel := &sels[i]
+		if sel.Kind() != KindCondition && sel.Kind() != KindField {
+			continue
+		}
+		b, ok := fields[sel.field]
+		if !ok {
+			b = &fieldBounds{}
+			fields[sel.field] = b
+		}
+		if sel.op == opExists {
+			exists := sel.value.(bool)
+			if b.exists != nil && *b.exists != exists {
+				return nil, false
+			}
+			b.exists = &exists
+			continue
+		}
+		b.valued = true
+		switch sel.op {
+		case opEq:
+			if b.eq != nil && !c.Eq(b.eq.value, sel.value) {
+				return nil, false
+			}
+			if b.eq == nil {
+				b.eq = sel
+			}
+		case opNE:
+			b.ne = append(b.ne, sel)
+		case opGT, opGTE:
+			if b.lower == nil || c.GT(sel.value, b.lower.value) ||
+				(c.Eq(sel.value, b.lower.value) && sel.op == opGT) {
+				b.lower = sel
+			}
+		case opLT, opLTE:
+			if b.upper == nil || c.LT(sel.value, b.upper.value) ||
+				(c.Eq(sel.value, b.upper.value) && sel.op == opLT) {
+				b.upper = sel
+			}
+		}
+	}
+	for _, b := range fields {
+		if !b.satisfiable(c) {
+			return nil, false
+		}
+	}
+	var result []Selector
+	for i := range sels {
+		sel := &sels[i]
+		if b, ok := fields[sel.field]; ok && !b.keep(sel) {
+			continue
+		}
+		result = append(result, *sel)
+	}
+	return result, true
+}
+
+// satisfiable returns false if the conditions in b contradict each other.
+func (b *fieldBounds) satisfiable(c collate.Collation) bool {
+	if b.exists != nil && !*b.exists && b.valued {
+		return false
+	}
+	if b.eq != nil {
+		for _, ne := range b.ne {
+			if c.Eq(b.eq.value, ne.value) {
+				return false
+			}
+		}
+		return (b.lower == nil || b.lower.matchesValue(c, b.eq.value)) &&
+			(b.upper == nil || b.upper.matchesValue(c, b.eq.value))
+	}
+	if b.lower == nil || b.upper == nil {
+		return true
+	}
+	if c.Eq(b.lower.value, b.upper.value) {
+		return b.lower.op == opGTE && b.upper.op == opLTE
+	}
+	return c.LT(b.lower.value, b.upper.value)
+}
+
+// matchesValue returns true if the range condition s matches v.
+func (s *Selector) matchesValue(c collate.Collation, v interface{}) bool {
+	switch s.op {
+	case opGT:
+		return c.GT(v, s.value)
+	case opGTE:
+		return c.GTE(v, s.value)
+	case opLT:
+		return c.LT(v, s.value)
+	}
+	return c.LTE(v, s.value)
+}
+
+// keep returns true if sel, a condition on b's field, is not implied by the
+// other conditions on the field.
+func (b *fieldBounds) keep(sel *Selector) bool {
+	switch sel.op {
+	case opExists:
+		return !b.valued
+	case opEq:
+		return sel == b.eq
+	case opNE:
+		return b.eq == nil
+	case opGT, opGTE:
+		return b.eq == nil && sel == b.lower
+	case opLT, opLTE:
+		return b.eq == nil && sel == b.upper
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package mango
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestNormalize(t *testing.T) {
+	type nTest struct {
+		name     string
+		input    string
+		expected string
+	}
+	tests := []nTest{
+		{
+			name:     "already normal",
+			input:    `{"a":1}`,
+			expected: `{"a":{"$eq":1}}`,
+		},
+		{
+			name:     "nested $and",
+			input:    `{"$and":[{"a":1},{"$and":[{"b":2},{"c":3}]}]}`,
+			expected: `{"$and":[{"a":{"$eq":1}},{"b":{"$eq":2}},{"c":{"$eq":3}}]}`,
+		},
+		{
+			name:     "nested $or",
+			input:    `{"$or":[{"a":1},{"$or":[{"b":2}]}]}`,
+			expected: `{"$or":[{"a":{"$eq":1}},{"b":{"$eq":2}}]}`,
+		},
+		{
+			name:     "single-element $and",
+			input:    `{"$and":[{"a":1}]}`,
+			expected: `{"a":{"$eq":1}}`,
+		},
+		{
+			name:     "duplicates",
+			input:    `{"$or":[{"a":1},{"b":2},{"a":{"$eq":1}}]}`,
+			expected: `{"$or":[{"a":{"$eq":1}},{"b":{"$eq":2}}]}`,
+		},
+		{
+			name:     "redundant lower bounds",
+			input:    `{"a":{"$gt":5},"$and":[{"a":{"$gt":3}}]}`,
+			expected: `{"a":{"$gt":5}}`,
+		},
+		{
+			name:     "exclusive bound wins",
+			input:    `{"a":{"$gte":5,"$gt":5,"$lte":"x","$lt":10}}`,
+			expected: `{"$and":[{"a":{"$gt":5}},{"a":{"$lt":10}}]}`,
+		},
+		{
+			name:     "$exists implied by bounds",
+			input:    `{"a":{"$gt":1,"$lte":5,"$ne":2,"$exists":true},"b":{"$exists":true}}`,
+			expected: `{"$and":[{"a":{"$gt":1}},{"a":{"$lte":5}},{"a":{"$ne":2}},{"b":{"$exists":true}}]}`,
+		},
+		{
+			name:     "$eq within bounds",
+			input:    `{"a":{"$gt":1,"$lte":5,"$ne":2,"$eq":3}}`,
+			expected: `{"a":{"$eq":3}}`,
+		},
+		{
+			name:     "$exists implied",
+			input:    `{"a":{"$exists":true,"$type":"string"}}`,
+			expected: `{"a":{"$type":"string"}}`,
+		},
+		{
+			name:     "empty range",
+			input:    `{"a":{"$gt":5,"$lt":3}}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "exclusive point range",
+			input:    `{"a":{"$gte":5,"$lt":5}}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "inclusive point range",
+			input:    `{"a":{"$gte":5,"$lte":5}}`,
+			expected: `{"$and":[{"a":{"$gte":5}},{"a":{"$lte":5}}]}`,
+		},
+		{
+			name:     "range across types",
+			input:    `{"a":{"$gt":"a","$lt":1}}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "conflicting $eq",
+			input:    `{"$and":[{"a":1},{"a":2}]}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "$eq outside range",
+			input:    `{"a":{"$eq":1,"$gte":2}}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "$eq and $ne",
+			input:    `{"a":{"$eq":1,"$ne":1}}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "$exists conflict",
+			input:    `{"a":{"$exists":false,"$gt":1}}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "empty $in",
+			input:    `{"a":{"$in":[]},"b":1}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "empty $all",
+			input:    `{"a":{"$all":[]},"b":1}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "unsatisfiable alternative",
+			input:    `{"$or":[{"a":{"$in":[]}},{"b":1}]}`,
+			expected: `{"b":{"$eq":1}}`,
+		},
+		{
+			name:     "no satisfiable alternatives",
+			input:    `{"$or":[{"a":{"$in":[]}}]}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "empty $or",
+			input:    `{"$or":[],"a":1}`,
+			expected: `{"a":{"$eq":1}}`,
+		},
+		{
+			name:     "always-true alternative",
+			input:    `{"$or":[{"a":1},{}]}`,
+			expected: `{}`,
+		},
+		{
+			name:     "double negation",
+			input:    `{"$not":{"$not":{"a":1}}}`,
+			expected: `{"a":{"$eq":1}}`,
+		},
+		{
+			name:     "$nor",
+			input:    `{"$nor":[{"a":1},{"$or":[{"b":2},{"a":1}]},{"c":{"$in":[]}}]}`,
+			expected: `{"$nor":[{"a":{"$eq":1}},{"b":{"$eq":2}}]}`,
+		},
+		{
+			name:     "$nor of everything",
+			input:    `{"$nor":[{"a":1},{}]}`,
+			expected: `{"$not":{}}`,
+		},
+		{
+			name:     "$elemMatch",
+			input:    `{"a":{"$elemMatch":{"$gt":1,"$gte":0}}}`,
+			expected: `{"a":{"$elemMatch":{"$gt":1}}}`,
+		},
+		{
+			name:     "unsatisfiable $elemMatch",
+			input:    `{"a":{"$elemMatch":{"$gt":1,"$lt":0}}}`,
+			expected: `{"$not":{}}`,
+		},
+	}
+	docs := []couchDoc{
+		{},
+		{"a": float64(1)},
+		{"a": float64(3), "b": float64(2)},
+		{"a": float64(5), "c": float64(3)},
+		{"a": float64(7), "b": float64(2), "c": float64(3)},
+		{"a": "x"},
+		{"a": []interface{}{float64(-1), float64(2)}},
+		{"a": nil, "b": float64(1)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sel := mustNew(test.input)
+			result := sel.Normalize()
+			data, err := json.Marshal(result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := testy.DiffText(test.expected, string(data)); d != nil {
+				t.Error(d)
+			}
+			for _, doc := range docs {
+				want, _ := sel.Matches(doc)
+				got, _ := result.Matches(doc)
+				if got != want {
+					t.Errorf("Normalized selector gives %t for %v, expected %t", got, doc, want)
+				}
+			}
+		})
+	}
+}
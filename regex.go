@@ -0,0 +1,281 @@
+package mango
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// compileRegex compiles the argument to $regex.
+//
+// CouchDB evaluates $regex with Erlang's re module, which is PCRE operating on
+// bytes rather than on UTF-8 characters, while Go's regexp package implements
+// RE2. To keep the two in agreement:
+//
+//   - PCRE constructs which RE2 cannot express, such as backreferences and
+//     lookaround assertions, are rejected with a descriptive error, rather
+//     than being approximated.
+//   - Patterns and subjects are matched byte-wise, so that . matches a single
+//     byte of a multi-byte character, as it does in CouchDB.
+//   - $ outside of multi-line mode also matches before a final newline, as in
+//     PCRE.
+//   - \s also matches a vertical tab, as in PCRE.
+//
+// Case-insensitive matching of bytes outside of the ASCII range may still
+// differ from CouchDB.
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if hasEscape(pattern, 'v') {
+		return nil, fmt.Errorf("invalid $regex pattern: `\\v` matches any vertical whitespace in PCRE; use an explicit character class instead")
+	}
+	// Parse the pattern as written first, so that errors refer to it.
+	if _, err := syntax.Parse(toBytewise(pattern), syntax.Perl); err != nil {
+		return nil, regexError(err)
+	}
+	re, err := syntax.Parse(toBytewise(pcreSpace(pattern)), syntax.Perl)
+	if err != nil {
+		return nil, regexError(err)
+	}
+	return regexp.Compile(pcreDollar(re).String())
+}
+
+// matchRegex returns true if re matches s, compiled by compileRegex.
+func matchRegex(re *regexp.Regexp, s string) bool {
+	return re.MatchString(toBytewise(s))
+}
+
+// regexError converts an error from regexp/syntax into one naming the
+// unsupported PCRE feature, where one can be identified.
+func regexError(err error) error {
+	serr, ok := err.(*syntax.Error)
+	if !ok {
+		return err
+	}
+	var feature string
+	switch serr.Code {
+	case syntax.ErrInvalidPerlOp, syntax.ErrInvalidNamedCapture:
+		switch {
+		case strings.HasPrefix(serr.Expr, "(?="), strings.HasPrefix(serr.Expr, "(?!"):
+			feature = "lookahead assertions"
+		case strings.HasPrefix(serr.Expr, "(?<="), strings.HasPrefix(serr.Expr, "(?<!"):
+			feature = "lookbehind assertions"
+		case strings.HasPrefix(serr.Expr, "(?>"):
+			feature = "atomic groups"
+		case strings.HasPrefix(serr.Expr, "(?#"):
+			feature = "comments"
+		case strings.HasPrefix(serr.Expr, "(?|"):
+			feature = "branch reset groups"
+		case strings.HasPrefix(serr.Expr, "(?("):
+			feature = "conditional groups"
+		}
+	case syntax.ErrInvalidEscape:
+		if len(serr.Expr) == 2 && strings.ContainsRune("123456789gk", rune(serr.Expr[1])) {
+			feature = "backreferences"
+		}
+	case syntax.ErrInvalidRepeatOp:
+		if strings.HasSuffix(serr.Expr, "+") {
+			feature = "possessive quantifiers"
+		}
+	}
+	if feature != "" {
+		return fmt.Errorf("invalid $regex pattern: %s are not supported: `%s`", feature, serr.Expr)
+	}
+	return fmt.Errorf("invalid $regex pattern: %s: `%s`", serr.Code, serr.Expr)
+}
+
+// hasEscape returns true if pattern contains the escape sequence \c, outside
+// of a \Q...\E quoted section.
+func hasEscape(pattern string, c byte) bool {
+	var quoted bool
+	for i := 0; i < len(pattern)-1; i++ {
+		if pattern[i] != '\\' {
+			continue
+		}
+		next := pattern[i+1]
+		i++
+		switch {
+		case quoted:
+			quoted = next != 'E'
+		case next == 'Q':
+			quoted = true
+		case next == c:
+			return true
+		}
+	}
+	return false
+}
+
+// pcreSpaces and pcreNonSpaces are the characters matched by \s and \S in
+// PCRE, as they would appear within a character class. Unlike in RE2, \s
+// matches the vertical tab.
+const (
+	pcreSpaces    = `\t\n\x0B\f\r `
+	pcreNonSpaces = `\x00-\x08\x0E-\x1F\x21-\x{10FFFF}`
+)
+
+// pcreSpace rewrites each \s and \S in pattern, outside of a \Q...\E quoted
+// section, to match the same characters as in PCRE.
+func pcreSpace(pattern string) string {
+	var b strings.Builder
+	var quoted, class bool
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '\\' || i == len(pattern)-1 {
+			switch {
+			case quoted:
+			case c == '[' && !class:
+				class = true
+				b.WriteByte(c)
+				// A ] immediately after [ or [^ is a literal.
+				if i+1 < len(pattern) && pattern[i+1] == '^' {
+					i++
+					b.WriteByte('^')
+				}
+				if i+1 < len(pattern) && pattern[i+1] == ']' {
+					i++
+					b.WriteByte(']')
+				}
+				continue
+			case c == '[' && strings.HasPrefix(pattern[i+1:], ":"):
+				// A POSIX class, such as [:space:], within a class.
+				if end := strings.Index(pattern[i:], ":]"); end > 0 {
+					b.WriteString(pattern[i : i+end+2])
+					i += end + 1
+					continue
+				}
+			case c == ']' && class:
+				class = false
+			}
+			b.WriteByte(c)
+			continue
+		}
+		next := pattern[i+1]
+		i++
+		switch {
+		case quoted:
+			quoted = next != 'E'
+		case next == 'Q':
+			quoted = true
+		case (next == 's' || next == 'S') && class:
+			if next == 's' {
+				b.WriteString(pcreSpaces)
+			} else {
+				b.WriteString(pcreNonSpaces)
+			}
+			// A - following a class escape is a literal in PCRE, but would
+			// form a range with the last of the characters written.
+			if i+1 < len(pattern) && pattern[i+1] == '-' {
+				b.WriteString(`\-`)
+				i++
+			}
+			continue
+		case next == 's':
+			b.WriteString("[" + pcreSpaces + "]")
+			continue
+		case next == 'S':
+			b.WriteString("[^" + pcreSpaces + "]")
+			continue
+		}
+		b.WriteByte('\\')
+		b.WriteByte(next)
+	}
+	return b.String()
+}
+
+// toBytewise maps each byte of s to the rune of the same value, so that
+// multi-byte UTF-8 sequences are matched one byte at a time.
+func toBytewise(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			runes := make([]rune, len(s))
+			for j := 0; j < len(s); j++ {
+				runes[j] = rune(s[j])
+			}
+			return string(runes)
+		}
+	}
+	return s
+}
+
+// pcreDollar rewrites each single-line $ in re to \n?\z, which like PCRE's $
+// matches at the end of the text, or before a newline at the end.
+func pcreDollar(re *syntax.Regexp) *syntax.Regexp {
+	if re.Op == syntax.OpEndText && re.Flags&syntax.WasDollar != 0 {
+		return &syntax.Regexp{
+			Op: syntax.OpConcat,
+			Sub: []*syntax.Regexp{
+				{
+					Op:  syntax.OpQuest,
+					Sub: []*syntax.Regexp{{Op: syntax.OpLiteral, Rune: []rune{'\n'}}},
+				},
+				{Op: syntax.OpEndText},
+			},
+		}
+	}
+	for i, sub := range re.Sub {
+		re.Sub[i] = pcreDollar(sub)
+	}
+	return re
+}
+
+// generateRegex returns a string matched by re, compiled by compileRegex, if
+// one can be found.
+func generateRegex(re *regexp.Regexp) (string, bool) {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	var runes []rune
+	if !generate(parsed.Simplify(), &runes) {
+		return "", false
+	}
+	// Patterns are matched byte-wise, so each rune is a single byte.
+	b := make([]byte, len(runes))
+	for i, r := range runes {
+		if r > 0xff {
+			return "", false
+		}
+		b[i] = byte(r)
+	}
+	if s := string(b); matchRegex(re, s) {
+		return s, true
+	}
+	return "", false
+}
+
+// generate appends to runes a sequence matched by re, taking the first
+// alternative, and the fewest repetitions, at each choice. Assertions are
+// ignored, so the result must be checked.
+func generate(re *syntax.Regexp, runes *[]rune) bool {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return false
+	case syntax.OpLiteral:
+		*runes = append(*runes, re.Rune...)
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return false
+		}
+		*runes = append(*runes, re.Rune[0])
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		*runes = append(*runes, 'a')
+	case syntax.OpCapture, syntax.OpPlus:
+		return generate(re.Sub[0], runes)
+	case syntax.OpRepeat:
+		for i := 0; i < re.Min; i++ {
+			if !generate(re.Sub[0], runes) {
+				return false
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !generate(sub, runes) {
+				return false
+			}
+		}
+	case syntax.OpAlternate:
+		return generate(re.Sub[0], runes)
+	}
+	return true
+}
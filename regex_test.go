@@ -0,0 +1,332 @@
+package mango
+
+import "testing"
+
+func TestCompileRegex(t *testing.T) {
+	type crTest struct {
+		name    string
+		pattern string
+		err     string
+	}
+	tests := []crTest{
+		{
+			name:    "simple",
+			pattern: "^A",
+		},
+		{
+			name:    "lookahead",
+			pattern: "foo(?=bar)",
+			err:     "invalid $regex pattern: lookahead assertions are not supported: `(?=`",
+		},
+		{
+			name:    "negative lookahead",
+			pattern: "foo(?!bar)",
+			err:     "invalid $regex pattern: lookahead assertions are not supported: `(?!`",
+		},
+		{
+			name:    "lookbehind",
+			pattern: "(?<=foo)bar",
+			err:     "invalid $regex pattern: lookbehind assertions are not supported: `(?<=foo)bar`",
+		},
+		{
+			name:    "negative lookbehind",
+			pattern: "(?<!foo)bar",
+			err:     "invalid $regex pattern: lookbehind assertions are not supported: `(?<!foo)bar`",
+		},
+		{
+			name:    "atomic group",
+			pattern: "(?>foo)",
+			err:     "invalid $regex pattern: atomic groups are not supported: `(?>`",
+		},
+		{
+			name:    "backreference",
+			pattern: `(a)\1`,
+			err:     "invalid $regex pattern: backreferences are not supported: `\\1`",
+		},
+		{
+			name:    "named backreference",
+			pattern: `(?P<a>a)\k<a>`,
+			err:     "invalid $regex pattern: backreferences are not supported: `\\k`",
+		},
+		{
+			name:    "possessive quantifier",
+			pattern: `a*+`,
+			err:     "invalid $regex pattern: possessive quantifiers are not supported: `*+`",
+		},
+		{
+			name:    "vertical whitespace",
+			pattern: `a\vb`,
+			err:     "invalid $regex pattern: `\\v` matches any vertical whitespace in PCRE; use an explicit character class instead",
+		},
+		{
+			name:    "quoted vertical whitespace",
+			pattern: `\Qa\vb\E`,
+		},
+		{
+			name:    "escaped backslash",
+			pattern: `a\\v`,
+		},
+		{
+			name:    "unsupported escape",
+			pattern: `a\Z`,
+			err:     "invalid $regex pattern: invalid escape sequence: `\\Z`",
+		},
+		{
+			name:    "invalid syntax after \\s",
+			pattern: `\s(`,
+			err:     "invalid $regex pattern: missing closing ): `\\s(`",
+		},
+		{
+			name:    "invalid syntax",
+			pattern: `a(`,
+			err:     "invalid $regex pattern: missing closing ): `a(`",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := compileRegex(test.pattern)
+			var msg string
+			if err != nil {
+				msg = err.Error()
+			}
+			if msg != test.err {
+				t.Errorf("Unexpected error: %s", msg)
+			}
+		})
+	}
+}
+
+func TestMatchRegex(t *testing.T) {
+	type mrTest struct {
+		name     string
+		pattern  string
+		input    string
+		expected bool
+	}
+	tests := []mrTest{
+		{
+			name:     "unanchored",
+			pattern:  "b",
+			input:    "abc",
+			expected: true,
+		},
+		{
+			name:     "anchored miss",
+			pattern:  "^b",
+			input:    "abc",
+			expected: false,
+		},
+		{
+			name:     "dollar at end",
+			pattern:  "c$",
+			input:    "abc",
+			expected: true,
+		},
+		{
+			name:     "dollar before final newline",
+			pattern:  "c$",
+			input:    "abc\n",
+			expected: true,
+		},
+		{
+			name:     "dollar before other newline",
+			pattern:  "c$",
+			input:    "abc\n\n",
+			expected: false,
+		},
+		{
+			name:     "end of text before final newline",
+			pattern:  `c\z`,
+			input:    "abc\n",
+			expected: false,
+		},
+		{
+			name:     "multi-line dollar",
+			pattern:  "(?m)a$",
+			input:    "a\nb",
+			expected: true,
+		},
+		{
+			name:     "dot matches a single byte",
+			pattern:  "^.$",
+			input:    "é",
+			expected: false,
+		},
+		{
+			name:     "two dots match a two-byte character",
+			pattern:  "^..$",
+			input:    "é",
+			expected: true,
+		},
+		{
+			name:     "multi-byte literal",
+			pattern:  "^café",
+			input:    "café au lait",
+			expected: true,
+		},
+		{
+			name:     "case-insensitive",
+			pattern:  "(?i)^CAFE",
+			input:    "cafe",
+			expected: true,
+		},
+		{
+			name:     "\\s matches vertical tab",
+			pattern:  `^\s$`,
+			input:    "\v",
+			expected: true,
+		},
+		{
+			name:     "\\S does not match vertical tab",
+			pattern:  `^\S$`,
+			input:    "\v",
+			expected: false,
+		},
+		{
+			name:     "\\S matches a letter",
+			pattern:  `^\S$`,
+			input:    "a",
+			expected: true,
+		},
+		{
+			name:     "\\s in a class",
+			pattern:  `^[\s]$`,
+			input:    "\v",
+			expected: true,
+		},
+		{
+			name:     "\\s in a negated class",
+			pattern:  `^[^\s]$`,
+			input:    "\v",
+			expected: false,
+		},
+		{
+			name:     "\\S in a class",
+			pattern:  `^[\Sx]+$`,
+			input:    "é",
+			expected: true,
+		},
+		{
+			name:     "\\S in a negated class",
+			pattern:  `^[^\S]$`,
+			input:    "\v",
+			expected: true,
+		},
+		{
+			name:     "\\s followed by - in a class",
+			pattern:  `[\s-x]`,
+			input:    "a",
+			expected: false,
+		},
+		{
+			name:     "- after \\s in a class is literal",
+			pattern:  `^[\s-x]$`,
+			input:    "-",
+			expected: true,
+		},
+		{
+			name:     "\\S followed by - in a class",
+			pattern:  `^[^\S-x]$`,
+			input:    "-",
+			expected: false,
+		},
+		{
+			name:     "\\S followed by - in a class does not match vertical tab",
+			pattern:  `^[\S-x]$`,
+			input:    "\v",
+			expected: false,
+		},
+		{
+			name:     "\\S followed by - in a class matches a space",
+			pattern:  `^[^\S-x]$`,
+			input:    " ",
+			expected: true,
+		},
+		{
+			name:     "quoted \\s",
+			pattern:  `^\Q\s\E$`,
+			input:    "\\s",
+			expected: true,
+		},
+		{
+			name:     "escaped backslash before s",
+			pattern:  `^\\s$`,
+			input:    "\\s",
+			expected: true,
+		},
+		{
+			name:     "POSIX class before \\s",
+			pattern:  `^[[:alpha:]\s]+$`,
+			input:    "a\vb",
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			re, err := compileRegex(test.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result := matchRegex(re, test.input); result != test.expected {
+				t.Errorf("Expected %t, got %t", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestGenerateRegex(t *testing.T) {
+	type grTest struct {
+		name     string
+		pattern  string
+		expected string
+		ok       bool
+	}
+	tests := []grTest{
+		{
+			name:     "literal",
+			pattern:  "foo",
+			expected: "foo",
+			ok:       true,
+		},
+		{
+			name:     "anchored with classes and repetition",
+			pattern:  `^[a-c]\d{3}x*$`,
+			expected: "a000",
+			ok:       true,
+		},
+		{
+			name:     "alternation",
+			pattern:  "(cat|dog)s?",
+			expected: "cat",
+			ok:       true,
+		},
+		{
+			name:     "multi-byte",
+			pattern:  "^é+$",
+			expected: "é",
+			ok:       true,
+		},
+		{
+			name:     "case-insensitive",
+			pattern:  "(?i)^ab",
+			expected: "AB",
+			ok:       true,
+		},
+		{
+			name:    "unsatisfied assertion",
+			pattern: `a\bb`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			re, err := compileRegex(test.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, ok := generateRegex(re)
+			if ok != test.ok || result != test.expected {
+				t.Errorf("Expected %q, %t; got %q, %t", test.expected, test.ok, result, ok)
+			}
+		})
+	}
+}
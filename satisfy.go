@@ -0,0 +1,346 @@
+package mango
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"github.com/go-kivik/mango/collate"
+)
+
+// Satisfiability is the result of Satisfy.
+type Satisfiability int
+
+// Satisfiability results.
+const (
+	// Unknown means that it could not be determined whether any document
+	// matches the selector.
+	Unknown Satisfiability = iota
+	// Satisfiable means that some document matches the selector.
+	Satisfiable
+	// Unsatisfiable means that no document matches the selector.
+	Unsatisfiable
+)
+
+func (s Satisfiability) String() string {
+	switch s {
+	case Satisfiable:
+		return "satisfiable"
+	case Unsatisfiable:
+		return "unsatisfiable"
+	}
+	return "unknown"
+}
+
+// satisfyLimit is the maximum number of clauses in the disjunctive normal
+// form of a selector considered by Satisfy.
+const satisfyLimit = 256
+
+// Satisfy determines whether any document could match the selector. If so, it
+// also returns an example document, for which Matches returns true.
+//
+// The analysis is conservative, so Unknown is returned when a selector can
+// be shown neither to match some document, nor to match none. This may be
+// the case for selectors with many alternatives, or with conditions which
+// interact in complex ways, such as several $regex conditions on the same
+// field.
+//
+// Values are compared with raw collation, as by Matches; use a Matcher to
+// compare them with another collation.
+func (s *Selector) Satisfy() (Satisfiability, map[string]interface{}) {
+	return satisfyDoc(&collate.Raw{}, s)
+}
+
+// satisfyDoc determines whether any document matches s, comparing values
+// with c.
+func satisfyDoc(c collate.Collation, s *Selector) (Satisfiability, map[string]interface{}) {
+	result, v := satisfy(c, *s, true)
+	if result != Satisfiable {
+		return result, nil
+	}
+	return result, copyValue(v).(map[string]interface{})
+}
+
+// satisfy determines whether any value matches s, returning one which does.
+// If doc is true, the value must be an object, as for a document.
+func satisfy(c collate.Collation, s Selector, doc bool) (Satisfiability, interface{}) {
+	if n := normalize(c, s); n.isNever() {
+		return Unsatisfiable, nil
+	}
+	dnf, err := s.DNF(satisfyLimit)
+	if err != nil {
+		return Unknown, nil
+	}
+	terms := []Selector{*dnf}
+	if dnf.op == opOr {
+		terms = dnf.sel
+	}
+	result := Unsatisfiable
+	for _, term := range terms {
+		if n := normalize(c, term); n.isNever() {
+			continue
+		}
+		literals := []Selector{term}
+		if term.op == opAnd {
+			literals = term.sel
+		}
+		if v, ok := solve(c, literals, doc); ok {
+			if m, _ := s.match(c, v); m {
+				return Satisfiable, v
+			}
+		}
+		result = Unknown
+	}
+	return result, nil
+}
+
+// literalField returns the field a literal of a normal form applies to.
+func literalField(lit *Selector) string {
+	if lit.op == opNot {
+		return lit.sel[0].field
+	}
+	return lit.field
+}
+
+// solve returns a value matching all of literals, each of which is a
+// condition, $elemMatch or $allMatch, possibly negated. If doc is true, the
+// value must be an object.
+func solve(c collate.Collation, literals []Selector, doc bool) (interface{}, bool) {
+	var fields []string
+	byField := make(map[string][]Selector)
+	for _, lit := range literals {
+		if lit.op == opNone {
+			continue
+		}
+		field := literalField(&lit)
+		if _, ok := byField[field]; !ok {
+			fields = append(fields, field)
+		}
+		byField[field] = append(byField[field], lit)
+	}
+	if !doc && (len(fields) == 0 || len(fields) == 1 && fields[0] == "") {
+		v, _, ok := solveField(c, "", byField[""])
+		return v, ok
+	}
+	obj := map[string]interface{}{}
+	for _, field := range fields {
+		if field == "" {
+			continue
+		}
+		v, present, ok := solveField(c, field, byField[field])
+		if !ok {
+			return nil, false
+		}
+		if present {
+			path, _ := splitField(field)
+			setPath(obj, path, v)
+		}
+	}
+	// Any conditions on the value itself must also hold for the object.
+	return obj, matchAll(c, byField[""], obj)
+}
+
+// solveField returns a value for field which matches all of literals, or
+// false for present if the field should be omitted.
+func solveField(c collate.Collation, field string, literals []Selector) (value interface{}, present, ok bool) {
+	check := func(v interface{}) bool {
+		if field == "" {
+			return matchAll(c, literals, v)
+		}
+		path, _ := splitField(field)
+		doc := map[string]interface{}{}
+		setPath(doc, path, v)
+		return matchAll(c, literals, doc)
+	}
+	if field != "" && matchAll(c, literals, map[string]interface{}{}) {
+		return nil, false, true
+	}
+	for _, v := range candidates(c, literals) {
+		if check(v) {
+			return v, true, true
+		}
+	}
+	return nil, false, false
+}
+
+func matchAll(c collate.Collation, literals []Selector, v interface{}) bool {
+	for _, lit := range literals {
+		if m, _ := lit.match(c, v); !m {
+			return false
+		}
+	}
+	return true
+}
+
+// setPath sets the value found by following path from obj to v, creating
+// objects as required.
+func setPath(obj map[string]interface{}, path []string, v interface{}) {
+	for _, name := range path[:len(path)-1] {
+		next, ok := obj[name].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			obj[name] = next
+		}
+		obj = next
+	}
+	obj[path[len(path)-1]] = v
+}
+
+// genericCandidates are values of each type, tried for every field.
+var genericCandidates = []interface{}{
+	nil, false, true, float64(0), float64(1), "", "a",
+	[]interface{}{}, map[string]interface{}{},
+}
+
+// maxGeneratedSize is the largest array generated for $size.
+const maxGeneratedSize = 1000
+
+// candidates returns values which may match literals: the arguments of the
+// literals, values adjacent to them in collation order, and values of each
+// type.
+func candidates(c collate.Collation, literals []Selector) []interface{} {
+	var result []interface{}
+	var numbers []float64
+	add := func(values ...interface{}) {
+		for _, v := range values {
+			if f, ok := v.(float64); ok {
+				numbers = append(numbers, f)
+			}
+			result = append(result, v)
+		}
+	}
+	neighbors := func(v interface{}) {
+		add(v)
+		add(after(v))
+		if b, ok := before(v); ok {
+			add(b)
+		}
+	}
+	for _, lit := range literals {
+		negated := lit.op == opNot
+		if negated {
+			lit = lit.sel[0]
+		}
+		switch lit.op {
+		case opEq, opNE, opLT, opLTE, opGT, opGTE:
+			neighbors(lit.value)
+		case opIn, opNIn, opAll:
+			args := lit.value.([]interface{})
+			for _, arg := range args {
+				neighbors(arg)
+			}
+			add(args)
+			if len(args) == 1 {
+				if _, ok := args[0].([]interface{}); ok {
+					add(args[0])
+				}
+			}
+		case opType:
+			add(typeValue(lit.value.(string)))
+		case opSize:
+			if n, _ := toInteger(lit.value); n <= maxGeneratedSize {
+				add(make([]interface{}, int(n)), make([]interface{}, int(n)+1))
+			}
+		case opMod:
+			args := lit.value.([]interface{})
+			divisor, _ := toInteger(args[0])
+			remainder, _ := toInteger(args[1])
+			add(remainder, remainder+divisor, remainder+1)
+		case opRegex:
+			if s, ok := generateRegex(lit.re); ok {
+				add(s)
+			}
+		case opElemMatch, opAllMatch:
+			if negated {
+				continue
+			}
+			if result, v := satisfy(c, lit.sel[0], false); result == Satisfiable {
+				add([]interface{}{v})
+			}
+		}
+	}
+	// Values between numeric arguments, for ranges such as $gt:1, $lt:2.
+	sort.Float64s(numbers)
+	for i := 1; i < len(numbers); i++ {
+		result = append(result, (numbers[i-1]+numbers[i])/2)
+	}
+	return append(result, genericCandidates...)
+}
+
+// typeValue returns a value of the named type.
+func typeValue(typ string) interface{} {
+	switch typ {
+	case "boolean":
+		return false
+	case "number":
+		return float64(0)
+	case "string":
+		return ""
+	case "array":
+		return []interface{}{}
+	case "object":
+		return map[string]interface{}{}
+	}
+	return nil
+}
+
+// after returns a value which collates immediately, or shortly, after v.
+func after(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		if !t {
+			return true
+		}
+		return float64(0)
+	case float64:
+		return t + 1
+	case string:
+		return t + " "
+	case []interface{}:
+		return append(append([]interface{}{}, t...), nil)
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(t)+1)
+		var last string
+		for k, e := range t {
+			obj[k] = e
+			if k > last {
+				last = k
+			}
+		}
+		obj[last+" "] = nil
+		return obj
+	}
+	return nil
+}
+
+// before returns a value which collates immediately, or shortly, before v,
+// if there is one.
+func before(v interface{}) (interface{}, bool) {
+	switch t := v.(type) {
+	case bool:
+		if t {
+			return false, true
+		}
+		return nil, true
+	case float64:
+		return t - 1, true
+	case string:
+		if t == "" {
+			return float64(0), true
+		}
+		_, size := utf8.DecodeLastRuneInString(t)
+		return t[:len(t)-size], true
+	case []interface{}:
+		if len(t) == 0 {
+			return "", true
+		}
+		return t[:len(t)-1], true
+	case map[string]interface{}:
+		if len(t) == 0 {
+			return []interface{}{}, true
+		}
+		return map[string]interface{}{}, true
+	}
+	return nil, false
+}
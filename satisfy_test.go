@@ -0,0 +1,155 @@
+package mango
+
+import (
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestSatisfy(t *testing.T) {
+	type sTest struct {
+		name     string
+		input    string
+		expected Satisfiability
+		witness  map[string]interface{}
+	}
+	tests := []sTest{
+		{
+			name:     "empty",
+			input:    `{}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{},
+		},
+		{
+			name:     "equality",
+			input:    `{"a":1,"b.c":"x"}`,
+			expected: Satisfiable,
+			witness: map[string]interface{}{
+				"a": float64(1),
+				"b": map[string]interface{}{"c": "x"},
+			},
+		},
+		{
+			name:     "range",
+			input:    `{"a":{"$gt":1,"$lt":2}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": 1.5},
+		},
+		{
+			name:     "string range",
+			input:    `{"a":{"$gt":"a","$lt":"b"}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": "a "},
+		},
+		{
+			name:     "$exists false",
+			input:    `{"a":{"$exists":false}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{},
+		},
+		{
+			name:     "$ne",
+			input:    `{"a":{"$ne":null}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": false},
+		},
+		{
+			name:     "$not",
+			input:    `{"$not":{"a":{"$lt":5}},"a":{"$exists":true}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": float64(5)},
+		},
+		{
+			name:     "$nin and $type",
+			input:    `{"a":{"$nin":["a","b"],"$type":"string"}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": "a "},
+		},
+		{
+			name:     "$regex",
+			input:    `{"a":{"$regex":"^f(o+|x)[0-9]{2}$"}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": "fo00"},
+		},
+		{
+			name:     "$size",
+			input:    `{"a":{"$size":2}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": []interface{}{nil, nil}},
+		},
+		{
+			name:     "$mod",
+			input:    `{"a":{"$mod":[4,3]}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": float64(3)},
+		},
+		{
+			name:     "$all",
+			input:    `{"a":{"$all":["x","y"]}}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"a": []interface{}{"x", "y"}},
+		},
+		{
+			name:     "$elemMatch",
+			input:    `{"a":{"$elemMatch":{"b":{"$gte":3},"c":true}}}`,
+			expected: Satisfiable,
+			witness: map[string]interface{}{
+				"a": []interface{}{map[string]interface{}{"b": float64(3), "c": true}},
+			},
+		},
+		{
+			name:     "second alternative",
+			input:    `{"$or":[{"a":{"$gt":2,"$lt":1}},{"b":{"$in":[3]}}]}`,
+			expected: Satisfiable,
+			witness:  map[string]interface{}{"b": float64(3)},
+		},
+		{
+			name:     "empty range",
+			input:    `{"a":{"$gt":2,"$lt":1}}`,
+			expected: Unsatisfiable,
+		},
+		{
+			name:     "contradiction after negation",
+			input:    `{"a":1,"$nor":[{"a":{"$lt":5}}]}`,
+			expected: Unsatisfiable,
+		},
+		{
+			name:     "no alternatives",
+			input:    `{"$or":[{"a":{"$in":[]}},{"b":{"$eq":1,"$exists":false}}]}`,
+			expected: Unsatisfiable,
+		},
+		{
+			name:     "unsatisfiable $elemMatch",
+			input:    `{"a":{"$elemMatch":{"$gt":1,"$lt":0}}}`,
+			expected: Unsatisfiable,
+		},
+		{
+			name:     "conflicting regexes",
+			input:    `{"a":{"$regex":"^x","$not":{"$regex":"^x"}}}`,
+			expected: Unknown,
+		},
+		{
+			name:     "conflicting paths",
+			input:    `{"a":1,"a.b":2}`,
+			expected: Unknown,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sel := mustNew(test.input)
+			result, witness := sel.Satisfy()
+			if result != test.expected {
+				t.Errorf("Expected %s, got %s", test.expected, result)
+			}
+			if d := testy.DiffInterface(test.witness, witness); d != nil {
+				t.Error(d)
+			}
+			if witness == nil {
+				return
+			}
+			if m, _ := sel.Matches(witness); !m {
+				t.Errorf("Witness %v does not match", witness)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package mango
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-kivik/mango/collate"
+)
+
+// Template is a selector in which some values are placeholders, to be
+// substituted with Bind. A placeholder has the form {"$param":"name"}, and
+// may be used in place of any value, such as {"year":{"$gte":{"$param":"min"}}},
+// or {"genre":{"$param":"genre"}} as an implicit $eq. A placeholder may also
+// require its value to be of a type, as for $type, such as
+// {"$param":"min","$type":"number"}.
+//
+// Bound values are always treated as values, never as selectors, so input
+// substituted into a template cannot change the query's structure.
+type Template struct {
+	sel Selector
+}
+
+// param is a placeholder for a value, parsed from {"$param":name}.
+type param struct {
+	name string
+	// typ is the type the value must have, if any.
+	typ string
+}
+
+// NewTemplate parses a selector containing placeholders. Errors are returned
+// as *ParseError, and arguments containing placeholders are validated when
+// the template is bound.
+func NewTemplate(data string) (*Template, error) {
+	sel, err := parseSelector([]byte(data), true)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{sel: sel}, nil
+}
+
+// Params returns the sorted names of the template's placeholders.
+func (t *Template) Params() []string {
+	seen := make(map[string]bool)
+	var names []string
+	Inspect(&t.sel, func(s *Selector) bool {
+		if s != nil {
+			walkParams(s.value, func(p param) {
+				if !seen[p.name] {
+					seen[p.name] = true
+					names = append(names, p.name)
+				}
+			})
+		}
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+// Bind returns the selector obtained by substituting each placeholder with
+// the named value from values, which is converted to the value encoding/json
+// would decode from its JSON representation. It is an error for a value to
+// be missing, for a value to be given for which there is no placeholder, for
+// a value to be of the wrong type, or for an operator's argument to be
+// invalid once bound, which is returned as a *ParseError.
+func (t *Template) Bind(values map[string]interface{}) (*Selector, error) {
+	params := t.Params()
+	for name := range values {
+		if i := sort.SearchStrings(params, name); i == len(params) || params[i] != name {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+	decoded := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		value, err := decodedValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %s", name, err)
+		}
+		decoded[name] = value
+	}
+	sel, err := bind(t.sel, decoded)
+	if err != nil {
+		return nil, err
+	}
+	return &sel, nil
+}
+
+// bind returns a copy of s with placeholders substituted from values.
+func bind(s Selector, values map[string]interface{}) (Selector, error) {
+	if len(s.sel) > 0 {
+		sels := make([]Selector, len(s.sel))
+		for i, sel := range s.sel {
+			var err error
+			if sels[i], err = bind(sel, values); err != nil {
+				return Selector{}, err
+			}
+		}
+		s.sel = sels
+	}
+	if s.Kind() != KindCondition {
+		return s, nil
+	}
+	value, found, err := bindValue(s.value, values)
+	if err != nil || !found {
+		return s, err
+	}
+	return newCondition(s.field, s.op, value)
+}
+
+// bindValue substitutes the placeholders in v from values, and returns true
+// if there were any.
+func bindValue(v interface{}, values map[string]interface{}) (interface{}, bool, error) {
+	switch t := v.(type) {
+	case param:
+		value, ok := values[t.name]
+		if !ok {
+			return nil, false, fmt.Errorf("missing value for parameter %q", t.name)
+		}
+		if typ := collate.TypeName(value); t.typ != "" && typ != t.typ {
+			return nil, false, fmt.Errorf("parameter %q must be of type %s, not %s", t.name, t.typ, typ)
+		}
+		return value, true, nil
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		var found bool
+		for i, elem := range t {
+			value, ok, err := bindValue(elem, values)
+			if err != nil {
+				return nil, false, err
+			}
+			result[i], found = value, found || ok
+		}
+		return result, found, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(t))
+		var found bool
+		for k, elem := range t {
+			value, ok, err := bindValue(elem, values)
+			if err != nil {
+				return nil, false, err
+			}
+			result[k], found = value, found || ok
+		}
+		return result, found, nil
+	}
+	return v, false, nil
+}
+
+// walkParams calls fn for each placeholder in v.
+func walkParams(v interface{}, fn func(param)) {
+	switch t := v.(type) {
+	case param:
+		fn(t)
+	case []interface{}:
+		for _, elem := range t {
+			walkParams(elem, fn)
+		}
+	case map[string]interface{}:
+		for _, elem := range t {
+			walkParams(elem, fn)
+		}
+	}
+}
+
+// isPlaceholder returns true if v is an object with the key $param.
+func isPlaceholder(v interface{}) bool {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = obj[string(opParam)]
+	return ok
+}
+
+// placeholders returns v, a decoded JSON value, with each placeholder
+// replaced by a param, and true if there were any.
+func placeholders(v interface{}) (interface{}, bool, error) {
+	switch t := v.(type) {
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		var found bool
+		for i, elem := range t {
+			value, ok, err := placeholders(elem)
+			if err != nil {
+				return nil, false, err
+			}
+			result[i], found = value, found || ok
+		}
+		return result, found, nil
+	case map[string]interface{}:
+		if isPlaceholder(t) {
+			p, err := newParam(t)
+			return p, err == nil, err
+		}
+		result := make(map[string]interface{}, len(t))
+		var found bool
+		for k, elem := range t {
+			value, ok, err := placeholders(elem)
+			if err != nil {
+				return nil, false, err
+			}
+			result[k], found = value, found || ok
+		}
+		return result, found, nil
+	}
+	return v, false, nil
+}
+
+// newParam parses a placeholder object.
+func newParam(obj map[string]interface{}) (param, error) {
+	name, ok := obj[string(opParam)].(string)
+	if !ok || name == "" {
+		return param{}, parseError(ReasonBadArg, opParam, obj, "placeholder name must be a non-empty string")
+	}
+	p := param{name: name}
+	for k, v := range obj {
+		switch k {
+		case string(opParam):
+		case string(opType):
+			typ, _ := v.(string)
+			if _, ok := typeNames[typ]; !ok {
+				return param{}, parseError(ReasonBadArg, opParam, obj, "placeholder $type must be one of null, boolean, number, string, array or object")
+			}
+			p.typ = typ
+		default:
+			return param{}, parseError(ReasonBadArg, opParam, obj, "placeholder may only have the keys $param and $type")
+		}
+	}
+	return p, nil
+}
+
+// typeNames are the types which may be named by $type.
+var typeNames = map[string]struct{}{
+	"null":    {},
+	"boolean": {},
+	"number":  {},
+	"string":  {},
+	"array":   {},
+	"object":  {},
+}
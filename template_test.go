@@ -0,0 +1,182 @@
+package mango
+
+import (
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestNewTemplate(t *testing.T) {
+	type ntTest struct {
+		name   string
+		input  string
+		params []string
+		err    string
+	}
+	tests := []ntTest{
+		{
+			name:  "no placeholders",
+			input: `{"a":1}`,
+		},
+		{
+			name:   "placeholders",
+			input:  `{"year":{"$gte":{"$param":"min"}},"genre":{"$param":"genre"},"tags":{"$in":[{"$param":"tag"},"x"]},"$or":[{"a":{"$param":"min"}}]}`,
+			params: []string{"genre", "min", "tag"},
+		},
+		{
+			name:   "within $elemMatch",
+			input:  `{"cast":{"$elemMatch":{"name":{"$param":"actor","$type":"string"}}}}`,
+			params: []string{"actor"},
+		},
+		{
+			name:   "whole argument",
+			input:  `{"a":{"$mod":{"$param":"mod"}}}`,
+			params: []string{"mod"},
+		},
+		{
+			name:  "invalid selector",
+			input: `{"a":{"$foo":1}}`,
+			err:   "/a/$foo: unknown mango operator '$foo'",
+		},
+		{
+			name:  "invalid argument without placeholders",
+			input: `{"a":{"$size":"x"}}`,
+			err:   "/a/$size: mango operator '$size' requires a non-negative integer argument",
+		},
+		{
+			name:  "invalid name",
+			input: `{"a":{"$eq":{"$param":1}}}`,
+			err:   "/a/$eq: placeholder name must be a non-empty string",
+		},
+		{
+			name:  "invalid type",
+			input: `{"a":{"$param":"x","$type":"int"}}`,
+			err:   "/a: placeholder $type must be one of null, boolean, number, string, array or object",
+		},
+		{
+			name:  "extra keys",
+			input: `{"a":{"$gt":{"$param":"x","b":1}}}`,
+			err:   "/a/$gt: placeholder may only have the keys $param and $type",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := NewTemplate(test.input)
+			testy.Error(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := testy.DiffInterface(test.params, tmpl.Params()); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestTemplateBind(t *testing.T) {
+	type tbTest struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected string
+		err      string
+	}
+	tests := []tbTest{
+		{
+			name:     "no placeholders",
+			template: `{"a":1}`,
+			expected: `{"a":1}`,
+		},
+		{
+			name:     "values",
+			template: `{"year":{"$gte":{"$param":"min"}},"genre":{"$param":"genre"},"tags":{"$in":[{"$param":"tag"},"x"]}}`,
+			values:   map[string]interface{}{"min": 1990, "genre": "Horror", "tag": "y"},
+			expected: `{"year":{"$gte":1990},"genre":"Horror","tags":{"$in":["y","x"]}}`,
+		},
+		{
+			name:     "value resembling a selector",
+			template: `{"a":{"$param":"x"}}`,
+			values:   map[string]interface{}{"x": map[string]interface{}{"$ne": 1}},
+			expected: `{"a":{"$eq":{"$ne":1}}}`,
+		},
+		{
+			name:     "whole argument",
+			template: `{"a":{"$in":{"$param":"list"}}}`,
+			values:   map[string]interface{}{"list": []string{"x", "y"}},
+			expected: `{"a":{"$in":["x","y"]}}`,
+		},
+		{
+			name:     "within $elemMatch",
+			template: `{"cast":{"$elemMatch":{"name":{"$param":"actor","$type":"string"}}}}`,
+			values:   map[string]interface{}{"actor": "Bela Lugosi"},
+			expected: `{"cast":{"$elemMatch":{"name":"Bela Lugosi"}}}`,
+		},
+		{
+			name:     "$regex",
+			template: `{"title":{"$regex":{"$param":"pattern"}}}`,
+			values:   map[string]interface{}{"pattern": "^A"},
+			expected: `{"title":{"$regex":"^A"}}`,
+		},
+		{
+			name:     "missing value",
+			template: `{"a":{"$param":"x"}}`,
+			err:      `missing value for parameter "x"`,
+		},
+		{
+			name:     "unknown parameter",
+			template: `{"a":{"$param":"x"}}`,
+			values:   map[string]interface{}{"x": 1, "y": 2},
+			err:      `unknown parameter "y"`,
+		},
+		{
+			name:     "wrong type",
+			template: `{"a":{"$gt":{"$param":"x","$type":"number"}}}`,
+			values:   map[string]interface{}{"x": "5"},
+			err:      `parameter "x" must be of type number, not string`,
+		},
+		{
+			name:     "invalid argument",
+			template: `{"a":{"$size":{"$param":"n"}}}`,
+			values:   map[string]interface{}{"n": -1},
+			err:      "mango operator '$size' requires a non-negative integer argument",
+		},
+		{
+			name:     "invalid regex",
+			template: `{"a":{"$regex":{"$param":"re"}}}`,
+			values:   map[string]interface{}{"re": "(?=x)"},
+			err:      "invalid $regex pattern: lookahead assertions are not supported: `(?=`",
+		},
+		{
+			name:     "unmarshalable value",
+			template: `{"a":{"$param":"x"}}`,
+			values:   map[string]interface{}{"x": make(chan int)},
+			err:      `parameter "x": json: unsupported type: chan int`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := NewTemplate(test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := tmpl.Bind(test.values)
+			testy.Error(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := testy.DiffInterface(mustNew(test.expected), result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestParamWithoutTemplate(t *testing.T) {
+	// Outside of a template, a placeholder is an ordinary value.
+	sel := mustNew(`{"a":{"$eq":{"$param":"x"}}}`)
+	if m, _ := sel.Matches(map[string]interface{}{"a": map[string]interface{}{"$param": "x"}}); !m {
+		t.Error("Expected a literal match")
+	}
+	_, err := New(`{"a":{"$param":"x"}}`)
+	testy.Error(t, "/a/$param: unknown mango operator '$param'", err)
+}